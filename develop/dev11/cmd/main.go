@@ -1,9 +1,18 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
 	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"dev11/internal/api"
+	"dev11/internal/auth"
 )
 
 /*
@@ -29,9 +38,36 @@ import (
 */
 
 func main() {
-	config := api.NewConfig("./configs/server.yaml")
-	server := api.NewServer(config)
-	if err := server.Start(); err != nil {
+	configPath := flag.String("config", "./configs/server.yaml", "path to the YAML configuration file")
+	tokenFor := flag.Int("issue-token", 0, "print a bearer token for the given user ID, signed with auth.token_secret, and exit")
+	tokenTTL := flag.Duration("token-ttl", 24*time.Hour, "validity period of the token printed by -issue-token")
+	flag.Parse()
+
+	config, err := api.NewConfig(*configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *tokenFor != 0 {
+		if config.Auth.TokenSecret == "" {
+			log.Fatal("auth.token_secret is not configured")
+		}
+		token, err := auth.NewTokens([]byte(config.Auth.TokenSecret)).Issue(*tokenFor, *tokenTTL)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(token)
+		return
+	}
+	slog.SetDefault(config.Log.Logger(os.Stderr))
+
+	server, err := api.NewServer(config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if err = server.Run(ctx); err != nil {
 		log.Fatal(err)
 	}
 }
@@ -39,13 +75,50 @@ func main() {
 /*
  - Usage: -
 [curl]
-curl -X POST http://localhost:8080/create_event -H "Content-Type: application/x-www-form-urlencoded" -d "id=1&title=My+Event&date=2025-01-16+15:30"
-curl -X GET http://localhost:8080/events_for_day
-curl -X GET http://localhost:8080/events_for_week
-curl -X POST http://localhost:8080/create_event -H "Content-Type: application/x-www-form-urlencoded" -d "id=2&title=Your+Event&date=2025-01-17+12:00"
-curl -X GET http://localhost:8080/events_for_month
-curl -X POST http://localhost:8080/update_event -H "Content-Type: application/x-www-form-urlencoded" -d "id=1&title=Update+Event&date=2025-01-17+17:00"
-curl -X GET http://localhost:8080/events_for_month
-curl -X POST http://localhost:8080/delete_event -H "Content-Type: application/x-www-form-urlencoded" -d "id=1&title=Update+Event&date=2025-01-17+17:00"
-curl -X GET http://localhost:8080/events_for_month
+curl -X POST http://localhost:8080/create_event -H "Content-Type: application/x-www-form-urlencoded" -d "user_id=1&id=1&title=My+Event&date=2025-01-16+15:30"
+curl -X GET "http://localhost:8080/events_for_day?user_id=1"
+curl -X GET "http://localhost:8080/events_for_week?user_id=1"
+curl -X POST http://localhost:8080/create_event -H "Content-Type: application/x-www-form-urlencoded" -d "user_id=1&id=2&title=Your+Event&date=2025-01-17+12:00"
+curl -X GET "http://localhost:8080/events_for_month?user_id=1"
+curl -X POST http://localhost:8080/update_event -H "Content-Type: application/x-www-form-urlencoded" -d "user_id=1&id=1&title=Update+Event&date=2025-01-17+17:00"
+curl -X GET "http://localhost:8080/events_for_month?user_id=1"
+curl -X POST http://localhost:8080/delete_event -H "Content-Type: application/x-www-form-urlencoded" -d "user_id=1&id=1&title=Update+Event&date=2025-01-17+17:00"
+curl -X GET "http://localhost:8080/events_for_month?user_id=1"
+curl -X GET "http://localhost:8080/events_for_day?user_id=1&date=2025-01-17"
+curl -X GET "http://localhost:8080/events_in_range?user_id=1&from=2025-01-01&to=2025-01-31"
+curl -X POST http://localhost:8080/create_event -H "Content-Type: application/x-www-form-urlencoded" -d "user_id=1&title=Standup&date=2025-01-20+10:00&repeat=weekly&by_day=mo,we,fr&count=10"
+curl -X POST http://localhost:8080/cancel_occurrence -H "Content-Type: application/x-www-form-urlencoded" -d "user_id=1&id=3&occurrence=2025-01-22+10:00"
+curl -X POST http://localhost:8080/move_occurrence -H "Content-Type: application/x-www-form-urlencoded" -d "user_id=1&id=3&occurrence=2025-01-24+10:00&date=2025-01-24+12:00"
+curl -X GET "http://localhost:8080/export.ics?user_id=1" -o calendar.ics
+curl -X POST "http://localhost:8080/import?user_id=2" -H "Content-Type: text/calendar" --data-binary @calendar.ics
+curl -X POST http://localhost:8080/create_event -H "Content-Type: application/x-www-form-urlencoded" -d "user_id=1&title=Late+Call&date=2025-01-17+01:30&tz=Europe/Moscow"
+curl -X GET "http://localhost:8080/events_for_day?user_id=1&date=2025-01-16&tz=UTC"
+curl -X POST http://localhost:8080/create_event -H "Content-Type: application/json" -d '{"user_id":1,"title":"JSON Event","date":"2025-01-18T09:00:00+03:00","time_zone":"Europe/Moscow"}'
+curl -X PATCH "http://localhost:8080/events/3?user_id=1" -H "Content-Type: application/json" -H 'If-Match: "1"' -d '{"title":"Daily Standup"}'
+curl -X POST http://localhost:8080/update_event -H "Content-Type: application/x-www-form-urlencoded" -d "user_id=1&id=3&repeat=none&version=2"
+curl -i -X POST http://localhost:8080/api/v1/events -H "Content-Type: application/json" -d '{"user_id":1,"title":"REST Event","date":"2025-01-19T10:00:00Z"}'
+curl -X GET "http://localhost:8080/api/v1/events?user_id=1&period=week&date=2025-01-19"
+curl -X PUT http://localhost:8080/api/v1/events/4 -H "Content-Type: application/json" -d '{"user_id":1,"title":"REST Event","date":"2025-01-19T11:00:00Z"}'
+curl -i -X DELETE "http://localhost:8080/api/v1/events/4?user_id=1"
+curl -i -X GET "http://localhost:8080/api/v1/events/99?user_id=1" -H "X-Request-ID: support-ticket-42"
+CALENDAR_AUTH_TOKEN_SECRET=0123456789abcdef0123456789abcdef go run ./cmd -issue-token 1
+curl -X GET "http://localhost:8080/api/v1/events" -H "Authorization: Bearer <token>"
+curl -X POST http://localhost:8080/delete_event -H "X-API-Key: <key>" -H "Content-Type: application/json" -d '{"id":1}'
+curl -X GET http://localhost:8080/metrics
+curl -X GET http://localhost:8080/healthz
+curl -X GET http://localhost:8080/readyz
+curl -X POST http://localhost:8080/create_event -H "Content-Type: application/x-www-form-urlencoded" -d "user_id=1&title=Call&date=2025-01-20+15:00&reminders=15,60"
+curl -N "http://localhost:8080/events/stream?user_id=1"
+curl -X POST http://localhost:8080/create_event -H "Content-Type: application/x-www-form-urlencoded" -d "user_id=1&title=Planning&date=2025-01-21+10:00&duration=90&location=Room+4&attendees=ann@example.com,bob@example.com&status=tentative"
+curl -X GET "http://localhost:8080/api/v1/events?user_id=1&from=2025-01-21+11:00&to=2025-01-22&overlapping=true"
+curl -X POST "http://localhost:8080/create_event?reject_overlap=true" -H "Content-Type: application/json" -d '{"user_id":1,"title":"Review","date":"2025-01-21T10:30:00Z","end":"2025-01-21T11:00:00Z"}'
+curl -X GET "http://localhost:8080/free_slots?user_id=1&date=2025-01-21&duration=60"
+curl -X GET "http://localhost:8080/events_for_month?user_id=1&date=2025-01-19&limit=20&sort=title&q=standup"
+curl -X GET "http://localhost:8080/events_for_month?user_id=1&date=2025-01-19&limit=20&sort=title&q=standup&page_token=<next_page_token>"
+curl -X POST http://localhost:8080/events/batch -H "Content-Type: application/json" -d '[{"op":"create","user_id":1,"title":"Sync","date":"2025-01-22T09:00:00Z"},{"op":"update","user_id":1,"id":2,"title":"Call with Ann"},{"op":"delete","user_id":1,"id":3}]'
+curl -X POST "http://localhost:8080/events/batch?mode=best_effort" -H "Content-Type: application/json" -d '[{"op":"delete","user_id":1,"id":3},{"op":"create","user_id":1,"title":"Retro","date":"2025-01-24T16:00:00Z"}]'
+curl -X GET "http://localhost:8080/trash?user_id=1"
+curl -X POST http://localhost:8080/restore_event -H "Content-Type: application/x-www-form-urlencoded" -d "user_id=1&id=3"
+curl -X GET "http://localhost:8080/events/1/history?user_id=1"
+curl -X GET "http://localhost:8080/audit?user_id=1&from=2025-01-20&to=2025-01-31"
 */
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"dev11/internal/auth"
+	"dev11/internal/calendar"
+	"dev11/internal/utils"
+)
+
+// systemActor is the actor of the changes the server makes on its own, such as purging the trash.
+const systemActor = "system"
+
+// auditor is implemented by storage backends that record the history of changes. As returns a view
+// of the storage whose changes are recorded as made by the actor.
+type auditor interface {
+	As(actor string) Storage
+	History(userID, ID int) []calendar.AuditEntry
+	AuditLog(filter calendar.AuditFilter) []calendar.AuditEntry
+}
+
+// errNoAudit is returned when the storage does not record the history of changes.
+var errNoAudit = errors.New("the storage does not record the history of changes")
+
+// auditedCalendar adapts a calendar to auditor: its views are returned as Storage, and adapted in turn,
+// rather than as *calendar.Calendar. The other capabilities of the calendar are promoted unchanged.
+type auditedCalendar struct {
+	*calendar.Calendar
+}
+
+// As returns a view of the calendar acting for the actor.
+func (c auditedCalendar) As(actor string) Storage {
+	return auditedCalendar{c.Calendar.As(actor)}
+}
+
+// storage returns the storage to make the changes requested by r with, so that they are recorded
+// as made by the client; see actorOf.
+func (s *Server) storage(r *http.Request) Storage {
+	return s.storageAs(actorOf(r))
+}
+
+// storageAs returns the storage acting for the actor, if the backend records actors, or the storage itself.
+func (s *Server) storageAs(actor string) Storage {
+	if audited, ok := s.calendar.(auditor); ok {
+		return audited.As(actor)
+	}
+	return s.calendar
+}
+
+// actorOf names the client of the request in the audit log: "user:<id>" for an authenticated user,
+// and "anonymous@<ip>" otherwise, as the user ID of an unauthenticated request is only a claim.
+func actorOf(r *http.Request) string {
+	if principal, ok := auth.FromContext(r.Context()); ok {
+		return fmt.Sprintf("user:%d", principal.UserID)
+	}
+	return "anonymous@" + clientKey(r)
+}
+
+// historyHandler handles GET /events/{id}/history, returning every change of the user's event, oldest first,
+// with the actor who made it, its time and the event before and after it. The history of a deleted
+// or purged event remains available.
+func (s *Server) historyHandler(w http.ResponseWriter, r *http.Request) {
+	// Checking the request method and Content-Type.
+	if !validateRequest(w, r, http.MethodGet) {
+		return
+	}
+
+	// Parsing the user ID and the event ID.
+	userID, ID, err := parseResourceKey(r)
+	if err != nil {
+		log.Println("Error parsing request:", err)
+		utils.SendError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	// Calling business logic.
+	audited, ok := s.calendar.(auditor)
+	if !ok {
+		utils.SendError(w, errNoAudit, http.StatusNotImplemented)
+		return
+	}
+	entries := audited.History(userID, ID)
+	if len(entries) == 0 {
+		sendStorageError(w, calendar.ErrNoSuchEvent)
+		return
+	}
+
+	// Return a successful response.
+	if err = utils.SendAuditEntries(w, entries); err != nil {
+		log.Println("Error writing response:", err)
+		utils.SendError(w, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// auditHandler handles GET /audit, returning the changes of all events, oldest first. The feed can be narrowed
+// to the changes made between 'from' and 'to', see utils.ParseRangeParams, and to the events of 'user_id';
+// an authenticated client only sees the changes of its own events.
+func (s *Server) auditHandler(w http.ResponseWriter, r *http.Request) {
+	// Checking the request method and Content-Type.
+	if !validateRequest(w, r, http.MethodGet) {
+		return
+	}
+
+	// Parsing the filters.
+	var filter calendar.AuditFilter
+	var err error
+	query := r.URL.Query()
+	if _, authenticated := auth.FromContext(r.Context()); authenticated || query.Has("user_id") {
+		if filter.UserID, err = utils.ParseUserID(r); err != nil {
+			log.Println("Error parsing query:", err)
+			utils.SendError(w, err, http.StatusBadRequest)
+			return
+		}
+	}
+	if query.Has("from") || query.Has("to") {
+		if filter.From, filter.To, err = utils.ParseRangeParams(r, s.location); err != nil {
+			log.Println("Error parsing query:", err)
+			utils.SendError(w, err, http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Calling business logic.
+	audited, ok := s.calendar.(auditor)
+	if !ok {
+		utils.SendError(w, errNoAudit, http.StatusNotImplemented)
+		return
+	}
+	entries := audited.AuditLog(filter)
+
+	// Return a successful response.
+	if err = utils.SendAuditEntries(w, entries); err != nil {
+		log.Println("Error writing response:", err)
+		utils.SendError(w, err, http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,140 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"dev11/internal/calendar"
+	"dev11/internal/utils"
+)
+
+// Modes of a batch.
+const (
+	batchAllOrNothing = "all_or_nothing"
+	batchBestEffort   = "best_effort"
+)
+
+// transactor is implemented by storage backends that can apply several operations atomically.
+type transactor interface {
+	Transaction(ops []calendar.Operation) ([]calendar.Event, error)
+}
+
+// batchHandler handles POST /events/batch, applying a JSON array of create, update and delete operations,
+// see utils.ParseBatch, in order. In the default 'all_or_nothing' mode either every operation is applied or,
+// if any of them is invalid or fails, none is and the request fails naming the operation; the storage must support
+// transactions. In the 'best_effort' mode every operation is applied on its own and the failed ones are reported
+// in the results.
+func (s *Server) batchHandler(w http.ResponseWriter, r *http.Request) {
+	// Checking the request method and Content-Type.
+	if !validateRequest(w, r, http.MethodPost, utils.JSONContentType) {
+		return
+	}
+
+	// Parsing the mode and the operations.
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = batchAllOrNothing
+	}
+	if mode != batchAllOrNothing && mode != batchBestEffort {
+		err := fmt.Errorf("mode %q is not one of %s, %s", mode, batchAllOrNothing, batchBestEffort)
+		log.Println("Error parsing query:", err)
+		utils.SendError(w, err, http.StatusBadRequest)
+		return
+	}
+	items, err := utils.ParseBatch(r, s.location)
+	if err != nil {
+		log.Println("Error parsing body:", err)
+		utils.SendError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	// Calling business logic.
+	var results []utils.OperationResult
+	if mode == batchBestEffort {
+		results = applyEach(s.storage(r), items)
+	} else if results, err = applyAll(s.storage(r), items); err != nil {
+		if errors.Is(err, errUnsupported) {
+			utils.SendError(w, err, http.StatusNotImplemented)
+			return
+		}
+		var invalid *calendar.OperationError
+		if errors.As(err, &invalid) && items[invalid.Index].Err != nil {
+			log.Println("Error parsing body:", err)
+			utils.SendError(w, err, http.StatusBadRequest)
+			return
+		}
+		sendStorageError(w, err)
+		return
+	}
+
+	// Return a successful response.
+	if err = utils.SendOperationResults(w, results); err != nil {
+		log.Println("Error writing response:", err)
+		utils.SendError(w, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// errUnsupported is returned by applyAll when the storage cannot apply operations atomically.
+var errUnsupported = errors.New("the storage does not support all-or-nothing batches, use mode=best_effort")
+
+// applyAll applies all operations to storage in a single transaction. An operation that could not be parsed
+// fails the batch with a *calendar.OperationError as a failed operation does.
+func applyAll(storage Storage, items []utils.BatchItem) ([]utils.OperationResult, error) {
+	ops := make([]calendar.Operation, len(items))
+	for i, item := range items {
+		if item.Err != nil {
+			return nil, &calendar.OperationError{Index: i, Err: item.Err}
+		}
+		ops[i] = item.Operation
+	}
+
+	tx, ok := storage.(transactor)
+	if !ok {
+		return nil, errUnsupported
+	}
+	events, err := tx.Transaction(ops)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]utils.OperationResult, len(events))
+	for i := range events {
+		results[i] = utils.OperationResult{Op: ops[i].Op, Event: &events[i]}
+	}
+	return results, nil
+}
+
+// applyEach applies every operation to storage on its own and reports the outcome of each.
+func applyEach(storage Storage, items []utils.BatchItem) []utils.OperationResult {
+	results := make([]utils.OperationResult, len(items))
+	for i, item := range items {
+		op := item.Operation
+		results[i].Op = op.Op
+		if item.Err != nil {
+			results[i].Error = item.Err.Error()
+			continue
+		}
+
+		var event *calendar.Event
+		var err error
+		switch op.Op {
+		case calendar.ChangeCreate:
+			event = op.Event
+			err = storage.CreateEvent(event)
+		case calendar.ChangeUpdate:
+			event, err = storage.UpdateEvent(op.UserID, op.ID, op.Patch, op.Version)
+		case calendar.ChangeDelete:
+			event, err = storage.DeleteEvent(op.UserID, op.ID)
+		}
+		if err != nil {
+			log.Printf("Error applying operation %d: %v", i, err)
+			results[i].Error = err.Error()
+			continue
+		}
+		results[i].Event = event
+	}
+	return results
+}
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"dev11/internal/calendar"
+	"dev11/internal/utils"
+)
+
+// createEvent creates the event in storage. If rejectOverlap is set, it fails with calendar.ErrOverlap
+// when the event would overlap another event of the user.
+func (s *Server) createEvent(storage Storage, event *calendar.Event, rejectOverlap bool) error {
+	if !rejectOverlap {
+		return storage.CreateEvent(event)
+	}
+
+	// No other booking may slip in between the check and the creation.
+	s.booking.Lock()
+	defer s.booking.Unlock()
+
+	if err := s.checkOverlap(*event); err != nil {
+		return err
+	}
+	return storage.CreateEvent(event)
+}
+
+// updateEvent applies the patch of params to the event in storage. If rejectOverlap is set, it fails with calendar.ErrOverlap
+// when the updated event would overlap another event of the user. The update is then made on condition
+// that the event has not changed since it was checked.
+func (s *Server) updateEvent(storage Storage, params *utils.PatchParams, rejectOverlap bool) (*calendar.Event, error) {
+	if !rejectOverlap {
+		return storage.UpdateEvent(params.UserID, params.ID, params.Patch, params.Version)
+	}
+
+	s.booking.Lock()
+	defer s.booking.Unlock()
+
+	current, err := s.calendar.GetEvent(params.UserID, params.ID)
+	if err != nil {
+		return nil, err
+	}
+	if params.Version != 0 && params.Version != current.Version {
+		return nil, calendar.ErrVersionMismatch
+	}
+	if err = s.checkOverlap(params.Patch.Apply(*current)); err != nil {
+		return nil, err
+	}
+	return storage.UpdateEvent(params.UserID, params.ID, params.Patch, current.Version)
+}
+
+// checkOverlap returns an error wrapping calendar.ErrOverlap and naming the first event the given event overlaps, if any.
+func (s *Server) checkOverlap(event calendar.Event) error {
+	overlapping := s.calendar.Overlapping(event)
+	if len(overlapping) == 0 {
+		return nil
+	}
+
+	other := overlapping[0]
+	return fmt.Errorf("%w: event №%d %q at %s", calendar.ErrOverlap, other.ID, other.Title, other.Date.Format(time.RFC3339))
+}
+
+// freeSlotsHandler handles GET /free_slots, returning the free windows of the user's working hours on 'date'
+// that last at least 'duration' minutes. The working hours are configured and taken in the 'tz' time zone;
+// on a day off there are no free slots.
+func (s *Server) freeSlotsHandler(w http.ResponseWriter, r *http.Request) {
+	// Checking the request method and Content-Type.
+	if !validateRequest(w, r, http.MethodGet) {
+		return
+	}
+
+	// Parsing the user ID, the date and the duration.
+	userID, err := utils.ParseUserID(r)
+	if err != nil {
+		log.Println("Error parsing query:", err)
+		utils.SendError(w, err, http.StatusBadRequest)
+		return
+	}
+	date, err := utils.ParseDateParam(r, "date", s.location)
+	if err != nil {
+		log.Println("Error parsing query:", err)
+		utils.SendError(w, err, http.StatusBadRequest)
+		return
+	}
+	minutes, err := strconv.Atoi(r.URL.Query().Get("duration"))
+	if err != nil || minutes <= 0 {
+		err = errors.New("duration must be a positive number of minutes")
+		log.Println("Error parsing query:", err)
+		utils.SendError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	// Calling business logic.
+	var slots []calendar.Slot
+	if from, to, ok := s.config.WorkingHours.On(date); ok {
+		busy := s.calendar.EventsOverlapping(userID, from, to)
+		slots = calendar.FreeSlots(busy, from, to, time.Duration(minutes)*time.Minute)
+	}
+
+	// Return a successful response.
+	if err = utils.SendSlots(w, slots); err != nil {
+		log.Println("Error writing response:", err)
+		utils.SendError(w, err, http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,230 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"slices"
+	"strconv"
+
+	"dev11/internal/auth"
+	"dev11/internal/utils"
+)
+
+// MiddlewareFunc wraps a handler to add behaviour before or after it.
+type MiddlewareFunc func(next http.Handler) http.Handler
+
+// Chain wraps the handler in the middlewares. The first middleware is the outermost one,
+// so it sees the request first and the response last.
+func Chain(handler http.Handler, middlewares ...MiddlewareFunc) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// Unless applies the middleware only to the requests that skip does not match.
+func Unless(skip func(r *http.Request) bool, middleware MiddlewareFunc) MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		wrapped := middleware(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if skip(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			wrapped.ServeHTTP(w, r)
+		})
+	}
+}
+
+// AccessLog assigns request IDs and logs every request to logger; see Middleware.
+func AccessLog(logger *slog.Logger) MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return NewMiddleware(next, logger)
+	}
+}
+
+// Recover turns a panic in the next handler into a 500 JSON error and logs it with the stack trace,
+// so that the connection is not dropped. If the response has already started, it is left as it is.
+func Recover(logger *slog.Logger) MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			recorder := &responseRecorder{ResponseWriter: w}
+			defer func() {
+				err := recover()
+				if err == nil {
+					return
+				}
+				if err == http.ErrAbortHandler {
+					panic(err)
+				}
+
+				logger.Error("handler panicked", "request_id", RequestID(r.Context()), "panic", err, "stack", string(debug.Stack()))
+				if recorder.status == 0 {
+					utils.SendError(w, errors.New("internal server error"), http.StatusInternalServerError)
+				}
+			}()
+			next.ServeHTTP(recorder, r)
+		})
+	}
+}
+
+// Methods and headers allowed in cross-origin requests, and response headers exposed to them.
+const (
+	corsAllowedMethods = "GET, POST, PUT, PATCH, DELETE"
+	corsAllowedHeaders = "Authorization, Content-Type, If-Match, X-Request-ID"
+	corsExposedHeaders = "ETag, Location, X-Request-ID"
+)
+
+// CORS allows cross-origin requests from the configured origins and answers their preflight requests.
+// Requests from other origins get no CORS headers and are therefore blocked by browsers.
+func CORS(config CORSConfig) MiddlewareFunc {
+	anyOrigin := slices.Contains(config.AllowedOrigins, "*")
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			w.Header().Add("Vary", "Origin")
+			if origin == "" || !(anyOrigin || slices.Contains(config.AllowedOrigins, origin)) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if anyOrigin {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			} else {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+			}
+			w.Header().Set("Access-Control-Expose-Headers", corsExposedHeaders)
+
+			// Preflight requests are answered here and never reach the router.
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				w.Header().Set("Access-Control-Allow-Methods", corsAllowedMethods)
+				w.Header().Set("Access-Control-Allow-Headers", corsAllowedHeaders)
+				w.Header().Set("Access-Control-Max-Age", "600")
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RateLimit rejects requests of a client that exceeds the limiter's rate with 429 Too Many Requests,
+// telling it in the Retry-After header how many seconds to wait.
+func RateLimit(limiter *RateLimiter) MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if wait, ok := limiter.Allow(clientKey(r)); !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				utils.SendError(w, errors.New("rate limit exceeded"), http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// clientKey identifies the client of a request by its IP address. Proxy headers such as X-Forwarded-For
+// are ignored, as clients could set them to escape the limit.
+func clientKey(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Authenticate requires every request to be accepted by one of the authenticators, which are tried in order,
+// and stores the principal in the request context. Other requests are rejected with 401 Unauthorized.
+func Authenticate(authenticators ...auth.Authenticator) MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			err := auth.ErrNoCredentials
+			for _, authenticator := range authenticators {
+				var principal *auth.Principal
+				principal, err = authenticator.Authenticate(r)
+				if err == nil {
+					next.ServeHTTP(w, r.WithContext(auth.NewContext(r.Context(), principal)))
+					return
+				}
+				if !errors.Is(err, auth.ErrNoCredentials) {
+					break
+				}
+			}
+
+			slog.Warn("authentication failed", "request_id", RequestID(r.Context()), "error", err)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="calendar"`)
+			if errors.Is(err, auth.ErrNoCredentials) {
+				err = errors.New("authentication required")
+			} else {
+				err = auth.ErrInvalidCredentials
+			}
+			utils.SendError(w, err, http.StatusUnauthorized)
+		})
+	}
+}
+
+// LimitBody rejects request bodies larger than maxBytes with 413 Request Entity Too Large: right away if the declared
+// Content-Length is too large, and otherwise, as for chunked bodies, by failing reads past the limit and turning
+// the 400 Bad Request the handler then responds with into 413.
+func LimitBody(maxBytes int64) MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > maxBytes {
+				err := fmt.Errorf("request body is larger than %d bytes", maxBytes)
+				utils.SendError(w, err, http.StatusRequestEntityTooLarge)
+				return
+			}
+			body := &limitedBody{ReadCloser: http.MaxBytesReader(w, r.Body, maxBytes)}
+			r.Body = body
+			next.ServeHTTP(&limitedWriter{ResponseWriter: w, body: body}, r)
+		})
+	}
+}
+
+// limitedBody wraps a body limited by http.MaxBytesReader to remember whether a read hit the limit.
+type limitedBody struct {
+	io.ReadCloser
+	exceeded bool
+}
+
+// Read reads from the body, noting a read past the limit.
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		b.exceeded = true
+	}
+	return n, err
+}
+
+// limitedWriter wraps a http.ResponseWriter to report a bad request whose body hit the limit as too large.
+type limitedWriter struct {
+	http.ResponseWriter
+	body *limitedBody
+}
+
+// WriteHeader passes the status code on, replacing 400 with 413 if the body was too large.
+func (lw *limitedWriter) WriteHeader(statusCode int) {
+	if statusCode == http.StatusBadRequest && lw.body.exceeded {
+		statusCode = http.StatusRequestEntityTooLarge
+	}
+	lw.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Flush sends any buffered data to the client if the underlying writer supports it.
+func (lw *limitedWriter) Flush() {
+	if flusher, ok := lw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer for http.ResponseController.
+func (lw *limitedWriter) Unwrap() http.ResponseWriter {
+	return lw.ResponseWriter
+}
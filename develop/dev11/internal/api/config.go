@@ -1,39 +1,452 @@
 package api
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
 	"log"
+	"log/slog"
+	"net"
 	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
+
+	"dev11/internal/auth"
+	"dev11/internal/reminder"
+	"dev11/internal/utils"
 )
 
+// envPrefix is prepended to the names of the environment variables that override the configuration.
+const envPrefix = "CALENDAR"
+
 // Config represents the configuration settings for the application,
 // including the address and port to which the application should bind,
-// specified by the 'addr_port' field in the YAML configuration file.
+// specified by the 'addr_port' field in the YAML configuration file,
+// the time zone of requests that do not pass the 'tz' parameter, specified by 'time_zone',
+// the storage backend described by the 'storage' section, the HTTP server 'timeouts',
+// the 'log', 'tls', 'cors', 'rate_limit', 'auth', 'reminders', 'stream', 'working_hours' and 'trash' sections,
+// and the largest accepted request body, 'max_body_bytes'.
+//
+// Every field can be overridden by an environment variable named after its YAML path,
+// e.g. CALENDAR_ADDR_PORT or CALENDAR_STORAGE_BACKEND. Lists are comma-separated.
 type Config struct {
-	AddrPort string `yaml:"addr_port"`
+	AddrPort     string             `yaml:"addr_port"`
+	TimeZone     string             `yaml:"time_zone"`
+	Storage      StorageConfig      `yaml:"storage"`
+	Timeouts     TimeoutsConfig     `yaml:"timeouts"`
+	Log          LogConfig          `yaml:"log"`
+	TLS          TLSConfig          `yaml:"tls"`
+	CORS         CORSConfig         `yaml:"cors"`
+	RateLimit    RateLimitConfig    `yaml:"rate_limit"`
+	MaxBodyBytes int64              `yaml:"max_body_bytes"`
+	Auth         AuthConfig         `yaml:"auth"`
+	Reminders    RemindersConfig    `yaml:"reminders"`
+	Stream       StreamConfig       `yaml:"stream"`
+	WorkingHours WorkingHoursConfig `yaml:"working_hours"`
+	Trash        TrashConfig        `yaml:"trash"`
+}
+
+// StorageConfig selects where calendar events are kept. The "memory" backend loses everything on restart;
+// the "file" backend keeps a journal and periodic snapshots in Dir, taking a snapshot every SnapshotEvery changes.
+// Both keep the AuditLimit most recent entries of the audit log.
+type StorageConfig struct {
+	Backend       string `yaml:"backend"`
+	Dir           string `yaml:"dir"`
+	SnapshotEvery int    `yaml:"snapshot_every"`
+	AuditLimit    int    `yaml:"audit_limit"`
+}
+
+// TimeoutsConfig holds the timeouts of the HTTP server, written as durations such as "10s".
+// Shutdown is how long in-flight requests may take to complete once the server is asked to stop.
+// ShutdownDelay is how long the server keeps accepting requests, failing its readiness check, before it stops,
+// so that load balancers polling /readyz take it out of rotation first.
+type TimeoutsConfig struct {
+	Read          time.Duration `yaml:"read"`
+	ReadHeader    time.Duration `yaml:"read_header"`
+	Write         time.Duration `yaml:"write"`
+	Idle          time.Duration `yaml:"idle"`
+	Shutdown      time.Duration `yaml:"shutdown"`
+	ShutdownDelay time.Duration `yaml:"shutdown_delay"`
+}
+
+// LogConfig sets the minimum level ("debug", "info", "warn" or "error") and the format ("text" or "json") of the log.
+type LogConfig struct {
+	Level  string `yaml:"level"`
+	Format string `yaml:"format"`
+}
+
+// TLSConfig holds the paths of the certificate and key files. The server uses HTTPS if both are set.
+type TLSConfig struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+}
+
+// CORSConfig lists the origins allowed to make cross-origin requests; "*" allows any origin.
+type CORSConfig struct {
+	AllowedOrigins []string `yaml:"allowed_origins"`
+}
+
+// RateLimitConfig limits every client to RequestsPerSecond on average, with bursts of up to Burst requests.
+// A zero rate disables the limit.
+type RateLimitConfig struct {
+	RequestsPerSecond float64 `yaml:"requests_per_second"`
+	Burst             int     `yaml:"burst"`
+}
+
+// AuthConfig turns authentication on when API keys or a token secret are set; otherwise the API is open
+// and every request names its user with 'user_id'. Each API key is written as "key:user_id".
+// Bearer tokens are HS256 JWTs signed with TokenSecret whose 'sub' claim is the user ID.
+type AuthConfig struct {
+	APIKeys     []string `yaml:"api_keys"`
+	TokenSecret string   `yaml:"token_secret"`
+}
+
+// RemindersConfig controls the delivery of event reminders: every Interval the due reminders are passed
+// to the Notifier, "log" or "webhook". The webhook posts them to WebhookURL, giving up after WebhookTimeout.
+type RemindersConfig struct {
+	Interval       time.Duration `yaml:"interval"`
+	Notifier       string        `yaml:"notifier"`
+	WebhookURL     string        `yaml:"webhook_url"`
+	WebhookTimeout time.Duration `yaml:"webhook_timeout"`
+}
+
+// StreamConfig sets how many recent changes the change stream keeps for clients that reconnect, LogSize,
+// and how often an idle stream sends a comment to keep the connection open, Heartbeat.
+type StreamConfig struct {
+	LogSize   int           `yaml:"log_size"`
+	Heartbeat time.Duration `yaml:"heartbeat"`
+}
+
+// WorkingHoursConfig sets the hours within which free slots are searched: from Start to End, written as "09:00",
+// on the Days given by their two-letter names, e.g. mo. The hours are taken in the time zone of the request.
+type WorkingHoursConfig struct {
+	Start string   `yaml:"start"`
+	End   string   `yaml:"end"`
+	Days  []string `yaml:"days"`
+}
+
+// TrashConfig sets how long deleted events stay in the trash, where they can be restored, before they are
+// purged for good, Retention, and how often the trash is checked for events to purge, PurgeInterval.
+type TrashConfig struct {
+	Retention     time.Duration `yaml:"retention"`
+	PurgeInterval time.Duration `yaml:"purge_interval"`
 }
 
-// NewConfig initializes a new Config object by attempting to load configuration from a specified YAML file.
-// If the file does not exist or an error occurs during reading or parsing, it returns a default configuration.
-func NewConfig(configPath string) *Config {
-	if _, err := os.Stat(configPath); os.IsNotExist(err) {
+// clockLayout is the format of the working hours.
+const clockLayout = "15:04"
+
+// minTokenSecretLength is the shortest accepted token secret, the size of an HS256 key.
+const minTokenSecretLength = 32
+
+// NewConfig loads the configuration from the specified YAML file on top of the defaults,
+// applies the environment overrides and validates the result. A missing file is not an error:
+// the defaults and the environment are used instead. Any other problem, including unknown fields
+// in the file, is returned as an error.
+func NewConfig(configPath string) (*Config, error) {
+	config := defaultConfig()
+
+	yamlFile, err := os.ReadFile(configPath)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
 		log.Println("Config file not found. Loading default config.")
-		return &Config{":8080"}
+	case err != nil:
+		return nil, fmt.Errorf("failed to read config %s: %w", configPath, err)
+	default:
+		decoder := yaml.NewDecoder(bytes.NewReader(yamlFile))
+		decoder.KnownFields(true)
+		if err = decoder.Decode(config); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("failed to parse config %s: %w", configPath, err)
+		}
 	}
 
-	yamlFile, err := os.ReadFile(configPath)
-	if err != nil {
-		log.Println("Error reading YAML file. Loading default config.")
-		return &Config{":8080"}
+	if err = applyEnv(envPrefix, reflect.ValueOf(config).Elem()); err != nil {
+		return nil, err
+	}
+	if err = config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
 	}
+	return config, nil
+}
 
-	var config Config
-	err = yaml.Unmarshal(yamlFile, &config)
-	if err != nil {
-		log.Println("Error parsing YAML file. Loading default config.")
-		return &Config{":8080"}
+// defaultConfig returns the configuration used when none is provided.
+func defaultConfig() *Config {
+	return &Config{
+		AddrPort: ":8080",
+		TimeZone: "UTC",
+		Storage: StorageConfig{
+			Backend:       "memory",
+			Dir:           "./data",
+			SnapshotEvery: 1000,
+			AuditLimit:    100000,
+		},
+		Timeouts: TimeoutsConfig{
+			Read:       10 * time.Second,
+			ReadHeader: 5 * time.Second,
+			Write:      10 * time.Second,
+			Idle:       60 * time.Second,
+			Shutdown:   15 * time.Second,
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: "json",
+		},
+		MaxBodyBytes: 1 << 20,
+		Reminders: RemindersConfig{
+			Interval:       30 * time.Second,
+			Notifier:       "log",
+			WebhookTimeout: 5 * time.Second,
+		},
+		Stream: StreamConfig{
+			LogSize:   1000,
+			Heartbeat: 15 * time.Second,
+		},
+		WorkingHours: WorkingHoursConfig{
+			Start: "09:00",
+			End:   "18:00",
+			Days:  []string{"mo", "tu", "we", "th", "fr"},
+		},
+		Trash: TrashConfig{
+			Retention:     30 * 24 * time.Hour,
+			PurgeInterval: time.Hour,
+		},
 	}
+}
 
-	return &config
+// Validate checks the whole configuration and reports every problem found.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	_, _, err := net.SplitHostPort(c.AddrPort)
+	check(err == nil, "addr_port %q is not a host:port address", c.AddrPort)
+	_, err = time.LoadLocation(c.TimeZone)
+	check(err == nil, "time_zone %q is not a known time zone", c.TimeZone)
+
+	switch c.Storage.Backend {
+	case "memory":
+	case "file":
+		check(c.Storage.Dir != "", "storage.dir is required for the file backend")
+	default:
+		check(false, "storage.backend %q is not one of memory, file", c.Storage.Backend)
+	}
+	check(c.Storage.SnapshotEvery > 0, "storage.snapshot_every must be positive")
+	check(c.Storage.AuditLimit > 0, "storage.audit_limit must be positive")
+
+	check(c.Timeouts.Read >= 0 && c.Timeouts.ReadHeader >= 0 && c.Timeouts.Write >= 0 && c.Timeouts.Idle >= 0 &&
+		c.Timeouts.ShutdownDelay >= 0, "timeouts must not be negative")
+	check(c.Timeouts.Shutdown > 0, "timeouts.shutdown must be positive")
+
+	var level slog.Level
+	check(level.UnmarshalText([]byte(c.Log.Level)) == nil, "log.level %q is not one of debug, info, warn, error", c.Log.Level)
+	check(c.Log.Format == "text" || c.Log.Format == "json", "log.format %q is not one of text, json", c.Log.Format)
+
+	check((c.TLS.CertFile == "") == (c.TLS.KeyFile == ""), "tls.cert_file and tls.key_file must be set together")
+	for _, file := range []string{c.TLS.CertFile, c.TLS.KeyFile} {
+		if file != "" {
+			_, err = os.Stat(file)
+			check(err == nil, "tls file %s is not accessible: %v", file, err)
+		}
+	}
+
+	for _, origin := range c.CORS.AllowedOrigins {
+		check(origin == "*" || strings.HasPrefix(origin, "http://") || strings.HasPrefix(origin, "https://"),
+			"cors.allowed_origins entry %q is not * or an http(s) origin", origin)
+	}
+
+	check(c.RateLimit.RequestsPerSecond >= 0, "rate_limit.requests_per_second must not be negative")
+	check(c.RateLimit.RequestsPerSecond == 0 || c.RateLimit.Burst > 0, "rate_limit.burst must be positive when the limit is on")
+
+	check(c.MaxBodyBytes > 0, "max_body_bytes must be positive")
+
+	check(c.Reminders.Interval > 0, "reminders.interval must be positive")
+	switch c.Reminders.Notifier {
+	case "log":
+	case "webhook":
+		check(strings.HasPrefix(c.Reminders.WebhookURL, "http://") || strings.HasPrefix(c.Reminders.WebhookURL, "https://"),
+			"reminders.webhook_url %q is not an http(s) URL", c.Reminders.WebhookURL)
+		check(c.Reminders.WebhookTimeout > 0, "reminders.webhook_timeout must be positive")
+	default:
+		check(false, "reminders.notifier %q is not one of log, webhook", c.Reminders.Notifier)
+	}
+
+	check(c.Stream.LogSize > 0, "stream.log_size must be positive")
+	check(c.Stream.Heartbeat > 0, "stream.heartbeat must be positive")
+
+	start, startErr := time.Parse(clockLayout, c.WorkingHours.Start)
+	check(startErr == nil, "working_hours.start %q is not in hh:mm format", c.WorkingHours.Start)
+	end, endErr := time.Parse(clockLayout, c.WorkingHours.End)
+	check(endErr == nil, "working_hours.end %q is not in hh:mm format", c.WorkingHours.End)
+	check(startErr != nil || endErr != nil || start.Before(end), "working_hours.start must be before working_hours.end")
+	for _, day := range c.WorkingHours.Days {
+		_, ok := utils.ParseWeekday(day)
+		check(ok, "working_hours.days entry %q is not a two-letter weekday", day)
+	}
+
+	check(c.Trash.Retention > 0, "trash.retention must be positive")
+	check(c.Trash.PurgeInterval > 0, "trash.purge_interval must be positive")
+
+	_, err = c.Auth.apiKeys()
+	check(err == nil, "auth.api_keys: %v", err)
+	check(c.Auth.TokenSecret == "" || len(c.Auth.TokenSecret) >= minTokenSecretLength,
+		"auth.token_secret must be at least %d bytes long", minTokenSecretLength)
+
+	return errors.Join(errs...)
+}
+
+// Enabled reports whether requests must be authenticated.
+func (c AuthConfig) Enabled() bool {
+	return len(c.APIKeys) > 0 || c.TokenSecret != ""
+}
+
+// Authenticators returns the authenticators of the configured credentials. The configuration is expected to be valid.
+func (c AuthConfig) Authenticators() []auth.Authenticator {
+	var authenticators []auth.Authenticator
+	if keys, _ := c.apiKeys(); len(keys) > 0 {
+		authenticators = append(authenticators, keys)
+	}
+	if c.TokenSecret != "" {
+		authenticators = append(authenticators, auth.NewTokens([]byte(c.TokenSecret)))
+	}
+	return authenticators
+}
+
+// apiKeys parses the "key:user_id" entries of APIKeys.
+func (c AuthConfig) apiKeys() (auth.APIKeys, error) {
+	keys := make(auth.APIKeys, len(c.APIKeys))
+	for _, entry := range c.APIKeys {
+		key, owner, ok := strings.Cut(entry, ":")
+		userID, err := strconv.Atoi(owner)
+		if !ok || key == "" || err != nil || userID <= 0 {
+			return nil, errors.New("every entry must be written as key:user_id")
+		}
+		if _, ok = keys[key]; ok {
+			return nil, errors.New("duplicate key")
+		}
+		keys[key] = userID
+	}
+	return keys, nil
+}
+
+// NewNotifier creates the configured notifier. The configuration is expected to be valid.
+func (c RemindersConfig) NewNotifier(logger *slog.Logger) reminder.Notifier {
+	if c.Notifier == "webhook" {
+		return reminder.NewWebhook(c.WebhookURL, c.WebhookTimeout)
+	}
+	return reminder.LogNotifier{Logger: logger}
+}
+
+// On returns the working hours of the day of date, in the location of date.
+// It reports false if the day is not a working day. The configuration is expected to be valid.
+func (c WorkingHoursConfig) On(date time.Time) (time.Time, time.Time, bool) {
+	if !slices.ContainsFunc(c.Days, func(name string) bool {
+		day, _ := utils.ParseWeekday(name)
+		return day == date.Weekday()
+	}) {
+		return time.Time{}, time.Time{}, false
+	}
+
+	at := func(clock string) time.Time {
+		t, _ := time.Parse(clockLayout, clock)
+		year, month, day := date.Date()
+		return time.Date(year, month, day, t.Hour(), t.Minute(), 0, 0, date.Location())
+	}
+	return at(c.Start), at(c.End), true
+}
+
+// Logger creates a logger writing to w with the configured level and format.
+// The configuration is expected to be valid.
+func (c LogConfig) Logger(w io.Writer) *slog.Logger {
+	var level slog.Level
+	_ = level.UnmarshalText([]byte(c.Level))
+	options := &slog.HandlerOptions{Level: level}
+
+	if c.Format == "json" {
+		return slog.New(slog.NewJSONHandler(w, options))
+	}
+	return slog.New(slog.NewTextHandler(w, options))
+}
+
+// applyEnv overrides the fields of the struct v with the environment variables named after their YAML tags,
+// descending into nested structs: the field 'dir' of 'storage' is overridden by PREFIX_STORAGE_DIR.
+func applyEnv(prefix string, v reflect.Value) error {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		tag, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if tag == "" || tag == "-" {
+			continue
+		}
+		name := prefix + "_" + strings.ToUpper(tag)
+
+		if field.Type.Kind() == reflect.Struct {
+			if err := applyEnv(name, v.Field(i)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := setFromString(v.Field(i), value); err != nil {
+			return fmt.Errorf("invalid value of %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// setFromString parses value into the field according to the field's type.
+func setFromString(field reflect.Value, value string) error {
+	if field.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported field type %s", field.Type())
+	}
+	return nil
 }
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNewConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.yaml")
+	data := "addr_port: ':9090'\ntimeouts:\n  write: '3s'\n"
+	t.Setenv("CALENDAR_STORAGE_DIR", "/tmp/events")
+	t.Setenv("CALENDAR_CORS_ALLOWED_ORIGINS", "https://a.example, https://b.example")
+	t.Setenv("CALENDAR_MAX_BODY_BYTES", "4096")
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := NewConfig(path)
+	if err != nil {
+		t.Fatalf("NewConfig failed: %v", err)
+	}
+	if config.AddrPort != ":9090" || config.Timeouts.Write != 3*time.Second {
+		t.Errorf("config = %+v, want addr :9090 and write timeout 3s", config)
+	}
+	if config.Timeouts.Shutdown != defaultConfig().Timeouts.Shutdown {
+		t.Errorf("shutdown timeout = %v, want the default", config.Timeouts.Shutdown)
+	}
+	if config.Storage.Dir != "/tmp/events" || len(config.CORS.AllowedOrigins) != 2 || config.MaxBodyBytes != 4096 {
+		t.Errorf("environment overrides were not applied: %+v", config)
+	}
+}
+
+func TestNewConfigRejectsInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		env  map[string]string
+	}{
+		{"malformed YAML", "addr_port: [", nil},
+		{"unknown field", "adr_port: ':8080'\n", nil},
+		{"bad address", "addr_port: '8080'\n", nil},
+		{"unknown backend", "storage:\n  backend: 'redis'\n", nil},
+		{"half of TLS", "tls:\n  cert_file: 'cert.pem'\n", nil},
+		{"bad environment value", "", map[string]string{"CALENDAR_TIMEOUTS_WRITE": "soon"}},
+		{"invalid environment override", "", map[string]string{"CALENDAR_LOG_FORMAT": "xml"}},
+		{"no body allowed", "max_body_bytes: 0\n", nil},
+		{"API key without user", "auth:\n  api_keys: ['secret']\n", nil},
+		{"short token secret", "", map[string]string{"CALENDAR_AUTH_TOKEN_SECRET": "short"}},
+		{"working hours backwards", "working_hours:\n  start: '18:00'\n  end: '09:00'\n", nil},
+		{"unknown working day", "", map[string]string{"CALENDAR_WORKING_HOURS_DAYS": "mo,funday"}},
+		{"no trash retention", "trash:\n  retention: '0s'\n", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "server.yaml")
+			if err := os.WriteFile(path, []byte(test.yaml), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			for name, value := range test.env {
+				t.Setenv(name, value)
+			}
+
+			if config, err := NewConfig(path); err == nil {
+				t.Errorf("NewConfig accepted the config: %+v", config)
+			}
+		})
+	}
+}
@@ -5,22 +5,33 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"strconv"
+	"slices"
+	"strings"
+	"time"
 
+	"dev11/internal/calendar"
 	"dev11/internal/utils"
 )
 
 // createEventHandler handles the creation of a new event by processing incoming HTTP POST requests.
 // It validates the request method and Content-Type, parses the event parameters,
 // invokes the business logic to create the event, and sends an appropriate response back to the client.
+// If the request carries no 'id', the server allocates one and reports it in the response.
+// With 'reject_overlap=true', an event that would overlap another event of the user is rejected.
 func (s *Server) createEventHandler(w http.ResponseWriter, r *http.Request) {
 	// Checking the request method and Content-Type.
-	if !validateRequest(w, r, http.MethodPost, "application/x-www-form-urlencoded") {
+	if !validateRequest(w, r, http.MethodPost, utils.FormContentType, utils.JSONContentType) {
 		return
 	}
 
 	// Parsing and creating an event object.
-	event, err := utils.ParseEventParams(r)
+	event, err := utils.ParseEventParams(r, s.location)
+	if err != nil {
+		log.Println("Error parsing form:", err)
+		utils.SendError(w, err, http.StatusBadRequest)
+		return
+	}
+	rejectOverlap, err := utils.ParseBoolParam(r, "reject_overlap")
 	if err != nil {
 		log.Println("Error parsing form:", err)
 		utils.SendError(w, err, http.StatusBadRequest)
@@ -28,10 +39,25 @@ func (s *Server) createEventHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Calling business logic.
-	s.calendar.CreateEvent(event)
+	err = s.createEvent(s.storage(r), event, rejectOverlap)
+	if errors.Is(err, calendar.ErrEventExists) || errors.Is(err, calendar.ErrOverlap) {
+		log.Println("Error creating event:", err)
+		utils.SendError(w, err, http.StatusServiceUnavailable)
+		return
+	}
+	if errors.Is(err, calendar.ErrInvalidEvent) {
+		log.Println("Error creating event:", err)
+		utils.SendError(w, err, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Println("Error saving data:", err)
+		utils.SendError(w, errors.New("failed to save event"), http.StatusInternalServerError)
+		return
+	}
 
 	// Return a successful response.
-	if err = utils.SendResult(w, "event created successfully"); err != nil {
+	if err = utils.SendResult(w, fmt.Sprintf("event №%d created successfully", event.ID)); err != nil {
 		log.Println("Error writing response:", err)
 		utils.SendError(w, err, http.StatusInternalServerError)
 		return
@@ -39,16 +65,25 @@ func (s *Server) createEventHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // updateEventHandler processes HTTP POST requests to update an existing event.
-// It validates the request method and Content-Type, parses the event parameters from the form data,
+// It validates the request method and Content-Type, parses the changed fields from the form data or JSON body,
 // and calls the calendar storage to update the event, sending appropriate responses based on the outcome.
+// Fields absent from the request keep their values; a 'version' or If-Match header makes the update conditional,
+// failing with 412 Precondition Failed if the event has changed since. With 'reject_overlap=true', an update that would make the event overlap another event of the user is rejected.
 func (s *Server) updateEventHandler(w http.ResponseWriter, r *http.Request) {
 	// Checking the request method and Content-Type.
-	if !validateRequest(w, r, http.MethodPost, "application/x-www-form-urlencoded") {
+	if !validateRequest(w, r, http.MethodPost, utils.FormContentType, utils.JSONContentType) {
 		return
 	}
 
-	// Parsing and creating an event object.
-	event, err := utils.ParseEventParams(r)
+	// Parsing the changed fields.
+	params, err := utils.ParsePatchParams(r, s.location)
+	if err == nil && params.ID == 0 {
+		err = errors.New("id is required")
+	}
+	var rejectOverlap bool
+	if err == nil {
+		rejectOverlap, err = utils.ParseBoolParam(r, "reject_overlap")
+	}
 	if err != nil {
 		log.Println("Error parsing form:", err)
 		utils.SendError(w, err, http.StatusBadRequest)
@@ -56,12 +91,27 @@ func (s *Server) updateEventHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Calling business logic.
-	err = s.calendar.UpdateEvent(event.ID, event.Title, event.Date)
-	if err != nil {
-		log.Println("Error updating data:", err)
+	_, err = s.updateEvent(s.storage(r), params, rejectOverlap)
+	if errors.Is(err, calendar.ErrNoSuchEvent) || errors.Is(err, calendar.ErrOverlap) {
+		log.Println("Error updating event:", err)
 		utils.SendError(w, err, http.StatusServiceUnavailable)
 		return
 	}
+	if errors.Is(err, calendar.ErrVersionMismatch) {
+		log.Println("Error updating event:", err)
+		utils.SendError(w, err, http.StatusPreconditionFailed)
+		return
+	}
+	if errors.Is(err, calendar.ErrInvalidEvent) {
+		log.Println("Error updating event:", err)
+		utils.SendError(w, err, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Println("Error saving data:", err)
+		utils.SendError(w, errors.New("failed to save event"), http.StatusInternalServerError)
+		return
+	}
 
 	// Return a successful response.
 	if err = utils.SendResult(w, "event updated successfully"); err != nil {
@@ -71,58 +121,162 @@ func (s *Server) updateEventHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// patchEventHandler processes HTTP PATCH requests to /events/{id} and /api/v1/events/{id}, changing only the fields present in the body.
+// The owner is given by the 'user_id' query parameter or body field. If the If-Match header or the 'version' field
+// does not match the current version of the event, the update is rejected with 412 Precondition Failed.
+// On success the updated event is returned together with its ETag.
+func (s *Server) patchEventHandler(w http.ResponseWriter, r *http.Request) {
+	// Checking the request method and Content-Type.
+	if !validateRequest(w, r, http.MethodPatch, utils.FormContentType, utils.JSONContentType) {
+		return
+	}
+
+	// Parsing the event ID from the path and the changed fields from the body.
+	ID, err := utils.ParsePathID(r)
+	if err != nil {
+		utils.SendError(w, err, http.StatusBadRequest)
+		return
+	}
+	params, err := utils.ParsePatchParams(r, s.location)
+	if err == nil && params.ID != 0 && params.ID != ID {
+		err = errors.New("id in the body does not match the path")
+	}
+	if err != nil {
+		log.Println("Error parsing body:", err)
+		utils.SendError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	// Calling business logic.
+	event, err := s.storage(r).UpdateEvent(params.UserID, ID, params.Patch, params.Version)
+	if err != nil {
+		sendStorageError(w, err)
+		return
+	}
+
+	// Return a successful response.
+	if err = utils.SendEvent(w, *event, http.StatusOK); err != nil {
+		log.Println("Error writing response:", err)
+		utils.SendError(w, err, http.StatusInternalServerError)
+		return
+	}
+}
+
 // deleteEventHandler handles the deletion of an event based on the provided ID in an HTTP POST request.
 // It validates the request method and Content-Type, parses the form data to extract the event ID,
 // and calls the calendar storage to delete the event, sending appropriate responses based on the outcome.
 func (s *Server) deleteEventHandler(w http.ResponseWriter, r *http.Request) {
 	// Checking the request method and Content-Type.
-	if !validateRequest(w, r, http.MethodPost, "application/x-www-form-urlencoded") {
+	if !validateRequest(w, r, http.MethodPost, utils.FormContentType, utils.JSONContentType) {
 		return
 	}
 
-	// Parse and get ID.
-	err := r.ParseForm()
+	// Parse and get the user ID and the event ID.
+	userID, ID, err := utils.ParseEventKey(r)
 	if err != nil {
 		log.Println("Error parsing form:", err)
-		utils.SendError(w, errors.New("invalid form data"), http.StatusBadRequest)
+		utils.SendError(w, err, http.StatusBadRequest)
 		return
 	}
-	ID, err := strconv.Atoi(r.FormValue("id"))
+
+	// Calling business logic.
+	deleted, err := s.storage(r).DeleteEvent(userID, ID)
+	if err != nil {
+		log.Println("Error deleting data:", err)
+		utils.SendError(w, err, http.StatusServiceUnavailable)
+		return
+	}
+
+	// Return a successful response.
+	err = utils.SendResult(w, fmt.Sprintf("event №%d [%s, %v] deleted", deleted.ID, deleted.Title, deleted.Date))
+	if err != nil {
+		log.Println("Error writing response:", err)
+		utils.SendError(w, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// cancelOccurrenceHandler handles HTTP POST requests to cancel a single occurrence of a recurring event.
+func (s *Server) cancelOccurrenceHandler(w http.ResponseWriter, r *http.Request) {
+	s.setException(w, r, false)
+}
+
+// moveOccurrenceHandler handles HTTP POST requests to move a single occurrence of a recurring event to a new date.
+func (s *Server) moveOccurrenceHandler(w http.ResponseWriter, r *http.Request) {
+	s.setException(w, r, true)
+}
+
+// setException parses an occurrence exception from the form data and stores it, sending
+// appropriate responses based on the outcome.
+func (s *Server) setException(w http.ResponseWriter, r *http.Request, moved bool) {
+	// Checking the request method and Content-Type.
+	if !validateRequest(w, r, http.MethodPost, utils.FormContentType) {
+		return
+	}
+
+	// Parsing the exception.
+	userID, ID, exception, err := utils.ParseExceptionParams(r, moved, s.location)
 	if err != nil {
 		log.Println("Error parsing form:", err)
-		utils.SendError(w, errors.New("id must be a valid integer"), http.StatusBadRequest)
+		utils.SendError(w, err, http.StatusBadRequest)
 		return
 	}
 
 	// Calling business logic.
-	deleted, err := s.calendar.DeleteEvent(ID)
+	err = s.storage(r).SetException(userID, ID, exception)
 	if err != nil {
-		log.Println("Error deleting data:", err)
+		log.Println("Error updating data:", err)
 		utils.SendError(w, err, http.StatusServiceUnavailable)
 		return
 	}
 
 	// Return a successful response.
-	err = utils.SendResult(w, fmt.Sprintf("event №%d [%s, %v] deleted", deleted.ID, deleted.Title, deleted.Date))
-	if err != nil {
+	result := "occurrence cancelled"
+	if moved {
+		result = "occurrence moved"
+	}
+	if err = utils.SendResult(w, result); err != nil {
 		log.Println("Error writing response:", err)
 		utils.SendError(w, err, http.StatusInternalServerError)
 		return
 	}
 }
 
-// getDailyEventHandler handles HTTP GET requests to retrieve events scheduled for the current day.
+// getDailyEventHandler handles HTTP GET requests to retrieve events scheduled for the day given by the 'date'
+// query parameter, or for the current day if it is omitted. Like every listing, the events are returned a page at a time;
+// see utils.ParseListOptions.
 func (s *Server) getDailyEventHandler(w http.ResponseWriter, r *http.Request) {
 	// Checking the request method and Content-Type.
-	if !validateRequest(w, r, http.MethodGet, "") {
+	if !validateRequest(w, r, http.MethodGet) {
+		return
+	}
+
+	// Parsing the user ID, the anchor date and the page.
+	userID, err := utils.ParseUserID(r)
+	if err != nil {
+		log.Println("Error parsing query:", err)
+		utils.SendError(w, err, http.StatusBadRequest)
+		return
+	}
+	date, err := utils.ParseDateParam(r, "date", s.location)
+	if err != nil {
+		log.Println("Error parsing query:", err)
+		utils.SendError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	options, err := utils.ParseListOptions(r)
+	if err != nil {
+		log.Println("Error parsing query:", err)
+		utils.SendError(w, err, http.StatusBadRequest)
 		return
 	}
 
 	// Calling business logic.
-	events := s.calendar.DailyEvents()
+	events := s.calendar.DailyEvents(userID, date)
 
 	// Return a successful response.
-	err := utils.SendEvents(w, events)
+	err = utils.SendEvents(w, calendar.Paginate(events, options))
 	if err != nil {
 		log.Println("Error writing response:", err)
 		utils.SendError(w, err, http.StatusInternalServerError)
@@ -130,18 +284,40 @@ func (s *Server) getDailyEventHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// getWeeklyEventHandler handles HTTP GET requests to retrieve events scheduled for the current week.
+// getWeeklyEventHandler handles HTTP GET requests to retrieve events scheduled for the week containing the 'date'
+// query parameter, or for the current week if it is omitted.
 func (s *Server) getWeeklyEventHandler(w http.ResponseWriter, r *http.Request) {
 	// Checking the request method and Content-Type.
-	if !validateRequest(w, r, http.MethodGet, "") {
+	if !validateRequest(w, r, http.MethodGet) {
+		return
+	}
+
+	// Parsing the user ID, the anchor date and the page.
+	userID, err := utils.ParseUserID(r)
+	if err != nil {
+		log.Println("Error parsing query:", err)
+		utils.SendError(w, err, http.StatusBadRequest)
+		return
+	}
+	date, err := utils.ParseDateParam(r, "date", s.location)
+	if err != nil {
+		log.Println("Error parsing query:", err)
+		utils.SendError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	options, err := utils.ParseListOptions(r)
+	if err != nil {
+		log.Println("Error parsing query:", err)
+		utils.SendError(w, err, http.StatusBadRequest)
 		return
 	}
 
 	// Calling business logic.
-	events := s.calendar.WeeklyEvents()
+	events := s.calendar.WeeklyEvents(userID, date)
 
 	// Return a successful response.
-	err := utils.SendEvents(w, events)
+	err = utils.SendEvents(w, calendar.Paginate(events, options))
 	if err != nil {
 		log.Println("Error writing response:", err)
 		utils.SendError(w, err, http.StatusInternalServerError)
@@ -149,18 +325,40 @@ func (s *Server) getWeeklyEventHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// getMonthlyEventHandler handles HTTP GET requests to get events scheduled for the current month.
+// getMonthlyEventHandler handles HTTP GET requests to get events scheduled for the month containing the 'date'
+// query parameter, or for the current month if it is omitted.
 func (s *Server) getMonthlyEventHandler(w http.ResponseWriter, r *http.Request) {
 	// Checking the request method and Content-Type.
-	if !validateRequest(w, r, http.MethodGet, "") {
+	if !validateRequest(w, r, http.MethodGet) {
+		return
+	}
+
+	// Parsing the user ID, the anchor date and the page.
+	userID, err := utils.ParseUserID(r)
+	if err != nil {
+		log.Println("Error parsing query:", err)
+		utils.SendError(w, err, http.StatusBadRequest)
+		return
+	}
+	date, err := utils.ParseDateParam(r, "date", s.location)
+	if err != nil {
+		log.Println("Error parsing query:", err)
+		utils.SendError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	options, err := utils.ParseListOptions(r)
+	if err != nil {
+		log.Println("Error parsing query:", err)
+		utils.SendError(w, err, http.StatusBadRequest)
 		return
 	}
 
 	// Calling business logic.
-	events := s.calendar.MonthlyEvents()
+	events := s.calendar.MonthlyEvents(userID, date)
 
 	// Return a successful response.
-	err := utils.SendEvents(w, events)
+	err = utils.SendEvents(w, calendar.Paginate(events, options))
 	if err != nil {
 		log.Println("Error writing response:", err)
 		utils.SendError(w, err, http.StatusInternalServerError)
@@ -168,8 +366,70 @@ func (s *Server) getMonthlyEventHandler(w http.ResponseWriter, r *http.Request)
 	}
 }
 
+// getRangeEventHandler handles HTTP GET requests to get events scheduled between the 'from' and 'to' query parameters.
+// With 'overlapping=true', events that started earlier but are still going on are included too.
+func (s *Server) getRangeEventHandler(w http.ResponseWriter, r *http.Request) {
+	// Checking the request method and Content-Type.
+	if !validateRequest(w, r, http.MethodGet) {
+		return
+	}
+
+	// Parsing the user ID, the range and the page.
+	userID, err := utils.ParseUserID(r)
+	if err != nil {
+		log.Println("Error parsing query:", err)
+		utils.SendError(w, err, http.StatusBadRequest)
+		return
+	}
+	from, to, err := utils.ParseRangeParams(r, s.location)
+	if err != nil {
+		log.Println("Error parsing query:", err)
+		utils.SendError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	options, err := utils.ParseListOptions(r)
+	if err != nil {
+		log.Println("Error parsing query:", err)
+		utils.SendError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	// Calling business logic.
+	events, err := s.rangeEvents(r, userID, from, to)
+	if err != nil {
+		log.Println("Error parsing query:", err)
+		utils.SendError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	// Return a successful response.
+	err = utils.SendEvents(w, calendar.Paginate(events, options))
+	if err != nil {
+		log.Println("Error writing response:", err)
+		utils.SendError(w, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// rangeEvents returns the user's events that start in [from, to) or, if the 'overlapping' query parameter
+// is true, the events that take place in it at least partly.
+func (s *Server) rangeEvents(r *http.Request, userID int, from, to time.Time) ([]calendar.Event, error) {
+	overlapping, err := utils.ParseBoolParam(r, "overlapping")
+	if err != nil {
+		return nil, err
+	}
+
+	if overlapping {
+		return s.calendar.EventsOverlapping(userID, from, to), nil
+	}
+	return s.calendar.EventsInRange(userID, from, to), nil
+}
+
 // validateRequest validates the HTTP method and Content-Type of a request.
-func validateRequest(w http.ResponseWriter, r *http.Request, expectedMethod, expectedContentType string) bool {
+// The body must have one of the expected media types; parameters such as charset are ignored.
+// If no media type is expected, any Content-Type is accepted.
+func validateRequest(w http.ResponseWriter, r *http.Request, expectedMethod string, expectedMediaTypes ...string) bool {
 	// Checking the request method.
 	if r.Method != expectedMethod {
 		log.Println("Invalid HTTP method used:", r.Method)
@@ -179,9 +439,13 @@ func validateRequest(w http.ResponseWriter, r *http.Request, expectedMethod, exp
 	}
 
 	// Checking Content-Type.
-	if r.Header.Get("Content-Type") != expectedContentType && expectedContentType != "" {
+	if len(expectedMediaTypes) == 0 {
+		return true
+	}
+	mediaType, err := utils.MediaType(r)
+	if err != nil || !slices.Contains(expectedMediaTypes, mediaType) {
 		log.Println("Invalid Content-Type:", r.Header.Get("Content-Type"))
-		errMessage := fmt.Sprintf("invalid Content-Type, expected %s", expectedContentType)
+		errMessage := fmt.Sprintf("invalid Content-Type, expected %s", strings.Join(expectedMediaTypes, " or "))
 		utils.SendError(w, errors.New(errMessage), http.StatusBadRequest)
 		return false
 	}
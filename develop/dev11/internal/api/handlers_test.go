@@ -0,0 +1,554 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newTestServer creates a server with the default in-memory configuration.
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+
+	server, err := NewServer(defaultConfig())
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	return server
+}
+
+// do sends a request straight to the server's handler and returns the recorded response.
+func do(server *Server, method, target, contentType, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+	w := httptest.NewRecorder()
+	server.httpServer.Handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestEventBodies(t *testing.T) {
+	server := newTestServer(t)
+	const form = "application/x-www-form-urlencoded; charset=utf-8"
+	const jsonType = "application/json"
+
+	tests := []struct {
+		name        string
+		target      string
+		contentType string
+		body        string
+		status      int
+	}{
+		{"form with charset", "/create_event", form, "user_id=1&title=Form&date=2025-01-16+10:00", http.StatusOK},
+		{"json create", "/create_event", jsonType, `{"user_id":1,"title":"JSON","date":"2025-01-16T12:00:00+03:00","time_zone":"Europe/Moscow"}`, http.StatusOK},
+		{"json unknown field", "/create_event", jsonType, `{"user_id":1,"title":"x","date":"2025-01-16T12:00:00Z","colour":"red"}`, http.StatusBadRequest},
+		{"json without title", "/create_event", jsonType, `{"user_id":1,"date":"2025-01-16T12:00:00Z"}`, http.StatusBadRequest},
+		{"unsupported type", "/create_event", "text/plain", "user_id=1", http.StatusBadRequest},
+		{"json update", "/update_event", jsonType + "; charset=utf-8", `{"user_id":1,"id":1,"title":"Renamed","date":"2025-01-16T11:00:00Z"}`, http.StatusOK},
+		{"json delete", "/delete_event", jsonType, `{"user_id":1,"id":2}`, http.StatusOK},
+		{"json delete twice", "/delete_event", jsonType, `{"user_id":1,"id":2}`, http.StatusServiceUnavailable},
+	}
+
+	for _, test := range tests {
+		w := do(server, http.MethodPost, test.target, test.contentType, test.body)
+		if w.Code != test.status {
+			t.Errorf("%s: status = %d, want %d; body %s", test.name, w.Code, test.status, w.Body)
+		}
+	}
+
+	w := do(server, http.MethodGet, "/events_for_day?user_id=1&date=2025-01-16", "", "")
+	var result struct {
+		Result []struct {
+			Title string `json:"title"`
+		} `json:"result"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Result) != 1 || result.Result[0].Title != "Renamed" {
+		t.Errorf("events = %+v, want only the renamed one", result.Result)
+	}
+}
+
+func TestPatchEvent(t *testing.T) {
+	server := newTestServer(t)
+	w := do(server, http.MethodPost, "/create_event", "application/json",
+		`{"user_id":1,"title":"Standup","date":"2025-01-16T10:00:00Z"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("create: status = %d; body %s", w.Code, w.Body)
+	}
+
+	patch := func(target, ifMatch, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPatch, target, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		if ifMatch != "" {
+			r.Header.Set("If-Match", ifMatch)
+		}
+		w := httptest.NewRecorder()
+		server.httpServer.Handler.ServeHTTP(w, r)
+		return w
+	}
+
+	tests := []struct {
+		name    string
+		target  string
+		ifMatch string
+		body    string
+		status  int
+		etag    string
+	}{
+		{"title only", "/events/1?user_id=1", `"1"`, `{"title":"Retro"}`, http.StatusOK, `"2"`},
+		{"stale etag", "/events/1?user_id=1", `"1"`, `{"title":"Again"}`, http.StatusPreconditionFailed, ""},
+		{"stale body version", "/events/1?user_id=1", "", `{"version":1,"title":"Again"}`, http.StatusPreconditionFailed, ""},
+		{"unconditional", "/events/1", "", `{"user_id":1,"recurrence":{"freq":"daily","interval":1}}`, http.StatusOK, `"3"`},
+		{"null title", "/events/1?user_id=1", "", `{"title":null}`, http.StatusBadRequest, ""},
+		{"bad etag", "/events/1?user_id=1", "abc", `{"title":"x"}`, http.StatusBadRequest, ""},
+		{"other user", "/events/1?user_id=2", "", `{"title":"x"}`, http.StatusNotFound, ""},
+		{"missing event", "/events/9?user_id=1", "", `{"title":"x"}`, http.StatusNotFound, ""},
+	}
+
+	for _, test := range tests {
+		w := patch(test.target, test.ifMatch, test.body)
+		if w.Code != test.status {
+			t.Errorf("%s: status = %d, want %d; body %s", test.name, w.Code, test.status, w.Body)
+		}
+		if got := w.Header().Get("ETag"); got != test.etag {
+			t.Errorf("%s: ETag = %q, want %q", test.name, got, test.etag)
+		}
+	}
+
+	w = do(server, http.MethodGet, "/events_for_day?user_id=1&date=2025-01-17", "", "")
+	if !strings.Contains(w.Body.String(), `"title":"Retro"`) {
+		t.Errorf("recurring patched event missing on the next day: %s", w.Body)
+	}
+}
+
+func TestEventDetails(t *testing.T) {
+	server := newTestServer(t)
+	const form = "application/x-www-form-urlencoded"
+	const jsonType = "application/json"
+
+	tests := []struct {
+		name        string
+		method      string
+		target      string
+		contentType string
+		body        string
+		status      int
+		want        string
+	}{
+		{"form details", http.MethodPost, "/create_event", form,
+			"user_id=1&title=Planning&date=2025-01-16+10:00&duration=90&location=Room+4&attendees=ann@example.com,+bob@example.com&status=tentative",
+			http.StatusOK, ""},
+		{"json details", http.MethodPost, "/api/v1/events", jsonType,
+			`{"user_id":1,"title":"Offsite","description":"Two days","date":"2025-01-16T09:00:00Z","end":"2025-01-17T18:00:00Z"}`,
+			http.StatusCreated, `"status":"confirmed"`},
+		{"end before start", http.MethodPost, "/create_event", form, "user_id=1&title=x&date=2025-01-16+10:00&end=2025-01-16+09:00", http.StatusBadRequest, "end must be after"},
+		{"end and duration", http.MethodPost, "/create_event", form, "user_id=1&title=x&date=2025-01-16+10:00&end=2025-01-16+11:00&duration=60", http.StatusBadRequest, ""},
+		{"bad attendee", http.MethodPost, "/api/v1/events", jsonType, `{"user_id":1,"title":"x","date":"2025-01-16T10:00:00Z","attendees":["ann"]}`, http.StatusBadRequest, ""},
+		{"bad status", http.MethodPost, "/create_event", form, "user_id=1&title=x&date=2025-01-16+10:00&status=maybe", http.StatusBadRequest, ""},
+		{"patch end", http.MethodPatch, "/api/v1/events/1?user_id=1", jsonType, `{"end":"2025-01-16T12:00:00Z","status":"confirmed"}`, http.StatusOK, `"end":"2025-01-16T12:00:00Z"`},
+		{"patch end before start", http.MethodPatch, "/api/v1/events/1?user_id=1", jsonType, `{"end":"2025-01-16T08:00:00Z"}`, http.StatusBadRequest, ""},
+		{"overlapping", http.MethodGet, "/api/v1/events?user_id=1&from=2025-01-17+12:00&to=2025-01-17&overlapping=true", "", "", http.StatusOK, `"title":"Offsite"`},
+		{"starting in range", http.MethodGet, "/events_in_range?user_id=1&from=2025-01-16+11:00&to=2025-01-17", "", "", http.StatusOK, `"result":null`},
+	}
+
+	for _, test := range tests {
+		w := do(server, test.method, test.target, test.contentType, test.body)
+		if w.Code != test.status {
+			t.Errorf("%s: status = %d, want %d; body %s", test.name, w.Code, test.status, w.Body)
+		}
+		if !strings.Contains(w.Body.String(), test.want) {
+			t.Errorf("%s: body %s does not contain %s", test.name, w.Body, test.want)
+		}
+	}
+}
+
+func TestPatchKeepsTimeZone(t *testing.T) {
+	server := newTestServer(t)
+	const form = "application/x-www-form-urlencoded"
+	const jsonType = "application/json"
+
+	do(server, http.MethodPost, "/api/v1/events", jsonType,
+		`{"user_id":1,"title":"Standup","date":"2025-01-16T10:00:00+03:00","time_zone":"Europe/Moscow","recurrence":{"freq":"daily"}}`)
+
+	tests := []struct {
+		name        string
+		method      string
+		target      string
+		contentType string
+		body        string
+		want        string
+		zone        string
+	}{
+		{"json date", http.MethodPatch, "/api/v1/events/1?user_id=1", jsonType, `{"date":"2025-01-17T08:00:00Z"}`,
+			`"date":"2025-01-17T11:00:00+03:00"`, "Europe/Moscow"},
+		{"form date", http.MethodPost, "/update_event", form, "user_id=1&id=1&date=2025-01-18+09:00",
+			`"date":"2025-01-18T09:00:00+03:00"`, "Europe/Moscow"},
+		{"form end", http.MethodPost, "/update_event", form, "user_id=1&id=1&end=2025-01-18+09:30",
+			`"end":"2025-01-18T09:30:00+03:00"`, "Europe/Moscow"},
+		{"json date in tz", http.MethodPatch, "/api/v1/events/1?user_id=1&tz=Asia/Tokyo", jsonType, `{"date":"2025-01-19T01:00:00Z"}`,
+			`"date":"2025-01-19T10:00:00+09:00"`, "Asia/Tokyo"},
+	}
+
+	for _, test := range tests {
+		if w := do(server, test.method, test.target, test.contentType, test.body); w.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d; body %s", test.name, w.Code, w.Body)
+		}
+		body := do(server, http.MethodGet, "/api/v1/events/1?user_id=1", "", "").Body.String()
+		if !strings.Contains(body, test.want) {
+			t.Errorf("%s: event %s does not contain %s", test.name, body, test.want)
+		}
+		if !strings.Contains(body, `"time_zone":"`+test.zone+`"`) {
+			t.Errorf("%s: event %s is not in %s", test.name, body, test.zone)
+		}
+	}
+}
+
+func TestBooking(t *testing.T) {
+	server := newTestServer(t)
+	const form = "application/x-www-form-urlencoded"
+	const jsonType = "application/json"
+
+	tests := []struct {
+		name        string
+		method      string
+		target      string
+		contentType string
+		body        string
+		status      int
+		want        string
+	}{
+		{"meeting", http.MethodPost, "/create_event", form, "user_id=1&title=Meeting&date=2025-01-16+10:00&duration=60", http.StatusOK, ""},
+		{"overlap allowed", http.MethodPost, "/create_event", form, "user_id=1&title=Call&date=2025-01-16+10:30&duration=15", http.StatusOK, ""},
+		{"overlap rejected", http.MethodPost, "/create_event", form,
+			"user_id=1&title=Review&date=2025-01-16+10:45&duration=30&reject_overlap=true", http.StatusServiceUnavailable, "event №1"},
+		{"json overlap rejected", http.MethodPost, "/create_event?reject_overlap=true", jsonType,
+			`{"user_id":1,"title":"Review","date":"2025-01-16T09:30:00Z","end":"2025-01-16T10:15:00Z"}`, http.StatusServiceUnavailable, "overlaps"},
+		{"free time", http.MethodPost, "/create_event?reject_overlap=true", jsonType,
+			`{"user_id":1,"title":"Lunch","date":"2025-01-16T12:00:00Z","end":"2025-01-16T13:00:00Z"}`, http.StatusOK, ""},
+		{"update rejected", http.MethodPost, "/update_event", form, "user_id=1&id=3&date=2025-01-16+10:30&reject_overlap=true", http.StatusServiceUnavailable, "overlaps"},
+		{"update allowed", http.MethodPost, "/update_event", form, "user_id=1&id=3&date=2025-01-16+13:00&reject_overlap=true", http.StatusOK, ""},
+		{"update ends before start", http.MethodPost, "/update_event", form, "user_id=1&id=3&end=2025-01-16+11:00", http.StatusBadRequest, "invalid event"},
+		{"update stale version", http.MethodPost, "/update_event", form, "user_id=1&id=3&version=1&title=Late", http.StatusPreconditionFailed, ""},
+		{"update unknown event", http.MethodPost, "/update_event", form, "user_id=1&id=9&title=Late", http.StatusServiceUnavailable, "no such event"},
+		{"bad flag", http.MethodPost, "/create_event", form, "user_id=1&title=x&date=2025-01-16+10:00&reject_overlap=maybe", http.StatusBadRequest, ""},
+		{"free slots", http.MethodGet, "/free_slots?user_id=1&date=2025-01-16&duration=90", "", "", http.StatusOK,
+			`{"result":[{"start":"2025-01-16T11:00:00Z","end":"2025-01-16T13:00:00Z"},{"start":"2025-01-16T14:00:00Z","end":"2025-01-16T18:00:00Z"}]}`},
+		{"day off", http.MethodGet, "/free_slots?user_id=1&date=2025-01-18&duration=30", "", "", http.StatusOK, `{"result":null}`},
+		{"no duration", http.MethodGet, "/free_slots?user_id=1&date=2025-01-16", "", "", http.StatusBadRequest, ""},
+	}
+
+	for _, test := range tests {
+		w := do(server, test.method, test.target, test.contentType, test.body)
+		if w.Code != test.status {
+			t.Errorf("%s: status = %d, want %d; body %s", test.name, w.Code, test.status, w.Body)
+		}
+		if !strings.Contains(w.Body.String(), test.want) {
+			t.Errorf("%s: body %s does not contain %s", test.name, w.Body, test.want)
+		}
+	}
+}
+
+func TestBatch(t *testing.T) {
+	server := newTestServer(t)
+	const jsonType = "application/json"
+	do(server, http.MethodPost, "/create_event", jsonType, `{"user_id":1,"title":"Existing","date":"2025-01-16T10:00:00Z"}`)
+
+	tests := []struct {
+		name   string
+		target string
+		body   string
+		status int
+		want   string
+	}{
+		{"invalid operation", "/events/batch", `[{"op":"create","user_id":1,"title":"New","date":"2025-01-16T12:00:00Z"},
+			{"op":"move","user_id":1,"id":1}]`, http.StatusBadRequest, `operation 1: op \"move\"`},
+		{"failed operation", "/events/batch", `[{"op":"create","user_id":1,"title":"New","date":"2025-01-16T12:00:00Z"},
+			{"op":"delete","user_id":1,"id":7}]`, http.StatusNotFound, "operation 1"},
+		{"stale version", "/events/batch", `[{"op":"update","user_id":1,"id":1,"version":5,"title":"x"}]`, http.StatusPreconditionFailed, ""},
+		{"all or nothing", "/events/batch", `[{"op":"create","user_id":1,"title":"New","date":"2025-01-16T12:00:00Z"},
+			{"op":"update","user_id":1,"id":2,"title":"Renamed"},{"op":"delete","user_id":1,"id":1}]`, http.StatusOK,
+			`"op":"update","event":{"id":2,"user_id":1,"title":"Renamed"`},
+		{"best effort", "/events/batch?mode=best_effort", `[{"op":"delete","user_id":1,"id":1},
+			{"op":"create","user_id":1,"title":"Third","date":"2025-01-17T12:00:00Z"},{"op":"update","user_id":1,"title":"x"}]`, http.StatusOK,
+			`{"op":"delete","error":"no such event"},{"op":"create","event":{"id":3,`},
+		{"unknown mode", "/events/batch?mode=some", `[{"op":"delete","user_id":1,"id":2}]`, http.StatusBadRequest, ""},
+		{"empty batch", "/events/batch", `[]`, http.StatusBadRequest, ""},
+	}
+
+	for _, test := range tests {
+		w := do(server, http.MethodPost, test.target, jsonType, test.body)
+		if w.Code != test.status {
+			t.Errorf("%s: status = %d, want %d; body %s", test.name, w.Code, test.status, w.Body)
+		}
+		if !strings.Contains(w.Body.String(), test.want) {
+			t.Errorf("%s: body %s does not contain %s", test.name, w.Body, test.want)
+		}
+	}
+
+	w := do(server, http.MethodGet, "/api/v1/events?user_id=1", "", "")
+	var listing struct {
+		Result []struct {
+			Title string `json:"title"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &listing); err != nil || len(listing.Result) != 2 ||
+		listing.Result[0].Title != "Renamed" || listing.Result[1].Title != "Third" {
+		t.Errorf("events after the batches = %s", w.Body)
+	}
+}
+
+func TestTrash(t *testing.T) {
+	server := newTestServer(t)
+	const form = "application/x-www-form-urlencoded"
+	do(server, http.MethodPost, "/create_event", form, "user_id=1&title=Meeting&date=2025-01-16+10:00")
+
+	tests := []struct {
+		name        string
+		method      string
+		target      string
+		contentType string
+		body        string
+		status      int
+		want        string
+	}{
+		{"delete", http.MethodPost, "/delete_event", form, "user_id=1&id=1", http.StatusOK, "deleted"},
+		{"hidden from listings", http.MethodGet, "/events_for_day?user_id=1&date=2025-01-16", "", "", http.StatusOK, `{"result":null}`},
+		{"hidden from the resource", http.MethodGet, "/api/v1/events/1?user_id=1", "", "", http.StatusNotFound, ""},
+		{"trash", http.MethodGet, "/trash?user_id=1", "", "", http.StatusOK, `"title":"Meeting"`},
+		{"trash of another user", http.MethodGet, "/trash?user_id=2", "", "", http.StatusOK, `{"result":null}`},
+		{"restore", http.MethodPost, "/restore_event", "application/json", `{"user_id":1,"id":1}`, http.StatusOK, "restored"},
+		{"restore twice", http.MethodPost, "/restore_event", form, "user_id=1&id=1", http.StatusServiceUnavailable, "no such event"},
+		{"listed again", http.MethodGet, "/events_for_day?user_id=1&date=2025-01-16", "", "", http.StatusOK, `"version":2`},
+		{"empty trash", http.MethodGet, "/trash?user_id=1", "", "", http.StatusOK, `{"result":null}`},
+	}
+
+	for _, test := range tests {
+		w := do(server, test.method, test.target, test.contentType, test.body)
+		if w.Code != test.status {
+			t.Errorf("%s: status = %d, want %d; body %s", test.name, w.Code, test.status, w.Body)
+		}
+		if !strings.Contains(w.Body.String(), test.want) {
+			t.Errorf("%s: body %s does not contain %s", test.name, w.Body, test.want)
+		}
+	}
+}
+
+func TestAuditHistory(t *testing.T) {
+	server := newTestServer(t)
+	const form = "application/x-www-form-urlencoded"
+	do(server, http.MethodPost, "/create_event", form, "user_id=1&title=Meeting&date=2025-01-16+10:00")
+	do(server, http.MethodPost, "/update_event", form, "user_id=1&id=1&date=2025-01-16+11:00")
+	do(server, http.MethodPost, "/create_event", form, "user_id=2&title=Other&date=2025-01-16+10:00")
+	do(server, http.MethodDelete, "/api/v1/events/1?user_id=1", "", "")
+
+	tests := []struct {
+		name   string
+		target string
+		status int
+		want   string
+	}{
+		{"history", "/events/1/history?user_id=1", http.StatusOK,
+			`"type":"update","user_id":1,"id":1,"actor":"anonymous@192.0.2.1"`},
+		{"before and after", "/events/1/history?user_id=1", http.StatusOK,
+			`"before":{"id":1,"user_id":1,"title":"Meeting","date":"2025-01-16T10:00:00Z"`},
+		{"deleted", "/events/1/history?user_id=1", http.StatusOK, `"type":"delete"`},
+		{"unknown event", "/events/7/history?user_id=1", http.StatusNotFound, ""},
+		{"feed of a user", "/audit?user_id=2", http.StatusOK, `"title":"Other"`},
+		{"feed of all users", "/audit", http.StatusOK, `"title":"Other"`},
+		{"feed of a past range", "/audit?from=2025-01-01&to=2025-01-31", http.StatusOK, `{"result":null}`},
+		{"bad range", "/audit?from=2025-01-31&to=2025-01-01", http.StatusBadRequest, ""},
+	}
+
+	for _, test := range tests {
+		w := do(server, http.MethodGet, test.target, "", "")
+		if w.Code != test.status {
+			t.Errorf("%s: status = %d, want %d; body %s", test.name, w.Code, test.status, w.Body)
+		}
+		if !strings.Contains(w.Body.String(), test.want) {
+			t.Errorf("%s: body %s does not contain %s", test.name, w.Body, test.want)
+		}
+	}
+
+	w := do(server, http.MethodGet, "/audit?user_id=1", "", "")
+	var feed struct {
+		Result []struct {
+			Type string `json:"type"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &feed); err != nil || len(feed.Result) != 3 {
+		t.Errorf("feed of user 1 = %s, want create, update and delete", w.Body)
+	}
+}
+
+func TestListingPages(t *testing.T) {
+	server := newTestServer(t)
+	for _, body := range []string{
+		"user_id=1&title=Standup&date=2025-01-13+10:00&repeat=daily&count=5",
+		"user_id=1&title=Retro&date=2025-01-17+15:00",
+		"user_id=1&title=Architecture+review&date=2025-01-15+12:00",
+	} {
+		if w := do(server, http.MethodPost, "/create_event", "application/x-www-form-urlencoded", body); w.Code != http.StatusOK {
+			t.Fatalf("create: status = %d; body %s", w.Code, w.Body)
+		}
+	}
+
+	type page struct {
+		Result []struct {
+			Title string `json:"title"`
+		} `json:"result"`
+		NextPageToken string `json:"next_page_token"`
+	}
+	titles := func(target string) []string {
+		var all []string
+		for token := ""; ; {
+			w := do(server, http.MethodGet, target+"&page_token="+token, "", "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("%s: status = %d; body %s", target, w.Code, w.Body)
+			}
+			var p page
+			if err := json.NewDecoder(w.Body).Decode(&p); err != nil {
+				t.Fatal(err)
+			}
+			for _, event := range p.Result {
+				all = append(all, event.Title)
+			}
+			if token = p.NextPageToken; token == "" {
+				return all
+			}
+		}
+	}
+
+	got := strings.Join(titles("/events_for_week?user_id=1&date=2025-01-15&limit=2&sort=title&q=r"), ",")
+	if want := "Architecture review,Retro"; got != want {
+		t.Errorf("titles = %s, want %s", got, want)
+	}
+	got = strings.Join(titles("/api/v1/events?user_id=1&from=2025-01-13&to=2025-01-17&limit=3"), ",")
+	if want := "Standup,Standup,Standup,Architecture review,Standup,Standup,Retro"; got != want {
+		t.Errorf("titles = %s, want %s", got, want)
+	}
+
+	w := do(server, http.MethodGet, "/events_for_week?user_id=1&date=2025-01-15&limit=2", "", "")
+	var first page
+	if err := json.NewDecoder(w.Body).Decode(&first); err != nil || first.NextPageToken == "" {
+		t.Fatalf("first page = %+v, %v; want a next page", first, err)
+	}
+	for _, target := range []string{
+		"/events_for_week?user_id=1&date=2025-01-15&sort=title&page_token=" + first.NextPageToken,
+		"/events_for_week?user_id=1&date=2025-01-15&page_token=garbage",
+		"/events_for_week?user_id=1&date=2025-01-15&limit=0",
+		"/events_for_week?user_id=1&date=2025-01-15&sort=size",
+	} {
+		if w = do(server, http.MethodGet, target, "", ""); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want %d", target, w.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestResourceRoutes(t *testing.T) {
+	server := newTestServer(t)
+	const jsonType = "application/json"
+
+	w := do(server, http.MethodPost, "/api/v1/events", jsonType, `{"user_id":1,"title":"Standup","date":"2025-01-16T10:00:00Z"}`)
+	if w.Code != http.StatusCreated || w.Header().Get("Location") != "/api/v1/events/1?user_id=1" {
+		t.Fatalf("create: status = %d, Location = %q; body %s", w.Code, w.Header().Get("Location"), w.Body)
+	}
+	// The legacy routes see events created through the resource tree and vice versa.
+	if w = do(server, http.MethodPost, "/create_event", jsonType, `{"user_id":1,"title":"Review","date":"2025-01-17T10:00:00Z"}`); w.Code != http.StatusOK {
+		t.Fatalf("legacy create: status = %d; body %s", w.Code, w.Body)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		status int
+		want   string
+	}{
+		{"get", http.MethodGet, "/api/v1/events/1?user_id=1", "", http.StatusOK, `"title":"Standup"`},
+		{"get other user", http.MethodGet, "/api/v1/events/1?user_id=2", "", http.StatusNotFound, ""},
+		{"get bad id", http.MethodGet, "/api/v1/events/x?user_id=1", "", http.StatusBadRequest, ""},
+		{"list all", http.MethodGet, "/api/v1/events?user_id=1", "", http.StatusOK, `"title":"Review"`},
+		{"list day", http.MethodGet, "/api/v1/events?user_id=1&period=day&date=2025-01-17", "", http.StatusOK, `"title":"Review"`},
+		{"list bad period", http.MethodGet, "/api/v1/events?user_id=1&period=year", "", http.StatusBadRequest, ""},
+		{"duplicate", http.MethodPost, "/api/v1/events", `{"user_id":1,"id":1,"title":"x","date":"2025-01-16T10:00:00Z"}`, http.StatusConflict, ""},
+		{"put", http.MethodPut, "/api/v1/events/2", `{"user_id":1,"title":"Retro","date":"2025-01-18T10:00:00Z"}`, http.StatusOK, `"title":"Retro"`},
+		{"put mismatched id", http.MethodPut, "/api/v1/events/2", `{"user_id":1,"id":3,"title":"x","date":"2025-01-18T10:00:00Z"}`, http.StatusBadRequest, ""},
+		{"put missing", http.MethodPut, "/api/v1/events/9", `{"user_id":1,"title":"x","date":"2025-01-18T10:00:00Z"}`, http.StatusNotFound, ""},
+		{"patch", http.MethodPatch, "/api/v1/events/1?user_id=1", `{"title":"Daily"}`, http.StatusOK, `"title":"Daily"`},
+		{"delete", http.MethodDelete, "/api/v1/events/1?user_id=1", "", http.StatusNoContent, ""},
+		{"delete again", http.MethodDelete, "/api/v1/events/1?user_id=1", "", http.StatusNotFound, ""},
+	}
+
+	for _, test := range tests {
+		contentType := ""
+		if test.body != "" {
+			contentType = jsonType
+		}
+		w := do(server, test.method, test.target, contentType, test.body)
+		if w.Code != test.status {
+			t.Errorf("%s: status = %d, want %d; body %s", test.name, w.Code, test.status, w.Body)
+		}
+		if !strings.Contains(w.Body.String(), test.want) {
+			t.Errorf("%s: body %s does not contain %s", test.name, w.Body, test.want)
+		}
+	}
+
+	w = do(server, http.MethodGet, "/events_for_week?user_id=1&date=2025-01-16", "", "")
+	if strings.Contains(w.Body.String(), "Daily") || !strings.Contains(w.Body.String(), "Retro") {
+		t.Errorf("legacy listing does not reflect the resource tree: %s", w.Body)
+	}
+}
+
+func TestAuthenticatedOwner(t *testing.T) {
+	config := defaultConfig()
+	config.Auth.APIKeys = []string{"alice-key:1", "bob-key:2"}
+	server, err := NewServer(config)
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+
+	send := func(method, target, key, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			r.Header.Set("X-API-Key", key)
+		}
+		w := httptest.NewRecorder()
+		server.httpServer.Handler.ServeHTTP(w, r)
+		return w
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		key    string
+		body   string
+		status int
+	}{
+		{"anonymous", http.MethodPost, "/create_event", "", `{"user_id":1,"title":"x","date":"2025-01-16T10:00:00Z"}`, http.StatusUnauthorized},
+		{"wrong key", http.MethodPost, "/create_event", "eve-key", `{"title":"x","date":"2025-01-16T10:00:00Z"}`, http.StatusUnauthorized},
+		{"owner from key", http.MethodPost, "/create_event", "alice-key", `{"title":"Alice","date":"2025-01-16T10:00:00Z"}`, http.StatusOK},
+		{"foreign user_id", http.MethodPost, "/create_event", "bob-key", `{"user_id":1,"title":"x","date":"2025-01-16T10:00:00Z"}`, http.StatusBadRequest},
+		{"delete foreign event", http.MethodPost, "/delete_event", "bob-key", `{"id":1}`, http.StatusServiceUnavailable},
+		{"read own", http.MethodGet, "/api/v1/events/1", "alice-key", "", http.StatusOK},
+		{"read foreign", http.MethodGet, "/api/v1/events/1?user_id=1", "bob-key", "", http.StatusBadRequest},
+		{"delete own", http.MethodDelete, "/api/v1/events/1", "alice-key", "", http.StatusNoContent},
+		{"own history", http.MethodGet, "/events/1/history", "alice-key", "", http.StatusOK},
+		{"foreign history", http.MethodGet, "/events/1/history?user_id=1", "bob-key", "", http.StatusBadRequest},
+		{"own audit feed", http.MethodGet, "/audit", "bob-key", "", http.StatusOK},
+	}
+
+	for _, test := range tests {
+		w := send(test.method, test.target, test.key, test.body)
+		if w.Code != test.status {
+			t.Errorf("%s: status = %d, want %d; body %s", test.name, w.Code, test.status, w.Body)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"dev11/internal/utils"
+)
+
+// readinessTimeout bounds the storage health check made by /readyz.
+const readinessTimeout = 2 * time.Second
+
+// HealthChecker is an optional capability of a Storage backend: CheckHealth reports whether
+// the storage is reachable and can accept writes. Backends without it are considered healthy.
+type HealthChecker interface {
+	CheckHealth(ctx context.Context) error
+}
+
+// healthHandler handles GET /healthz. It only tells that the process is alive and serving requests.
+func (s *Server) healthHandler(w http.ResponseWriter, r *http.Request) {
+	// Checking the request method and Content-Type.
+	if !validateRequest(w, r, http.MethodGet) {
+		return
+	}
+
+	// Return a successful response.
+	if err := utils.SendResult(w, "ok"); err != nil {
+		log.Println("Error writing response:", err)
+	}
+}
+
+// readyHandler handles GET /readyz. The server is ready when it is not shutting down
+// and the storage passes its health check; otherwise it responds with 503.
+func (s *Server) readyHandler(w http.ResponseWriter, r *http.Request) {
+	// Checking the request method and Content-Type.
+	if !validateRequest(w, r, http.MethodGet) {
+		return
+	}
+
+	if s.draining.Load() {
+		utils.SendError(w, errors.New("server is shutting down"), http.StatusServiceUnavailable)
+		return
+	}
+	if checker, ok := s.calendar.(HealthChecker); ok {
+		ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+		defer cancel()
+		if err := checker.CheckHealth(ctx); err != nil {
+			log.Println("Storage health check failed:", err)
+			utils.SendError(w, errors.New("storage is not available"), http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	// Return a successful response.
+	if err := utils.SendResult(w, "ready"); err != nil {
+		log.Println("Error writing response:", err)
+	}
+}
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"dev11/internal/calendar"
+	"dev11/internal/ical"
+	"dev11/internal/utils"
+)
+
+// exportHandler handles HTTP GET requests to download all events of a user as an iCalendar file.
+func (s *Server) exportHandler(w http.ResponseWriter, r *http.Request) {
+	// Checking the request method and Content-Type.
+	if !validateRequest(w, r, http.MethodGet) {
+		return
+	}
+
+	// Parsing the user ID.
+	userID, err := utils.ParseUserID(r)
+	if err != nil {
+		log.Println("Error parsing query:", err)
+		utils.SendError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	// Calling business logic.
+	events := s.calendar.AllEvents(userID)
+
+	// Return a successful response.
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="calendar.ics"`)
+	if err = ical.Encode(w, events, time.Now()); err != nil {
+		// The headers are already sent, so the error can only be logged.
+		log.Println("Error writing response:", err)
+	}
+}
+
+// importHandler handles HTTP POST requests carrying an iCalendar file and creates its events for the user
+// given by the 'user_id' query parameter. Every VEVENT is reported separately: events that cannot be
+// converted or stored are listed with an error, while the rest are created with new IDs.
+func (s *Server) importHandler(w http.ResponseWriter, r *http.Request) {
+	// Checking the request method and Content-Type.
+	if !validateRequest(w, r, http.MethodPost, "text/calendar") {
+		return
+	}
+
+	// Parsing the user ID, the time zone of floating times and the calendar.
+	userID, err := utils.ParseUserID(r)
+	if err != nil {
+		log.Println("Error parsing query:", err)
+		utils.SendError(w, err, http.StatusBadRequest)
+		return
+	}
+	loc, err := utils.ParseLocation(r, s.location)
+	if err != nil {
+		log.Println("Error parsing query:", err)
+		utils.SendError(w, err, http.StatusBadRequest)
+		return
+	}
+	items, err := ical.Decode(r.Body, loc)
+	if err != nil {
+		log.Println("Error parsing body:", err)
+		utils.SendError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	// Calling business logic: series first, then the occurrences they move.
+	storage := s.storage(r)
+	results := make([]utils.ItemResult, len(items))
+	created := make(map[string]int) // Event IDs by UID.
+	for i, item := range items {
+		results[i].Item = item.UID
+		if item.Err != nil || item.RecurrenceID != nil {
+			continue
+		}
+		event := item.Event
+		event.UserID = userID
+		if err = storage.CreateEvent(&event); err != nil {
+			log.Println("Error importing event:", err)
+			results[i].Error = err.Error()
+			continue
+		}
+		results[i].ID = event.ID
+		if item.UID != "" {
+			created[item.UID] = event.ID
+		}
+	}
+	for i, item := range items {
+		switch {
+		case item.Err != nil:
+			results[i].Error = item.Err.Error()
+		case item.RecurrenceID != nil:
+			results[i].ID, err = importOccurrence(storage, userID, item, created)
+			if err != nil {
+				log.Println("Error importing occurrence:", err)
+				results[i].Error = err.Error()
+			}
+		}
+	}
+
+	// Return a successful response.
+	if err = utils.SendItemResults(w, results); err != nil {
+		log.Println("Error writing response:", err)
+		utils.SendError(w, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// importOccurrence applies an imported override of a single occurrence to the series created in storage
+// from the same import, returning the ID of the series.
+func importOccurrence(storage Storage, userID int, item ical.Item, created map[string]int) (int, error) {
+	ID, ok := created[item.UID]
+	if !ok {
+		return 0, errors.New("no recurring event with this UID in the import")
+	}
+
+	date := item.Event.Date
+	exception := calendar.Exception{Occurrence: *item.RecurrenceID, Date: &date}
+	if err := storage.SetException(userID, ID, exception); err != nil {
+		return 0, fmt.Errorf("occurrence %s: %w", item.RecurrenceID.Format(time.RFC3339), err)
+	}
+	return ID, nil
+}
@@ -0,0 +1,182 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// durationBuckets are the upper bounds, in seconds, of the request latency histogram.
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// unmatchedRoute labels requests that did not match any route, so unknown paths cannot inflate the number of series.
+const unmatchedRoute = "unmatched"
+
+// Metrics collects request statistics in the middleware layer and writes them in the Prometheus text format.
+type Metrics struct {
+	mu       sync.Mutex
+	requests map[requestLabels]*requestSeries
+	inFlight atomic.Int64
+}
+
+// requestLabels identify a series of requests: the route pattern that served them and the response status.
+type requestLabels struct {
+	route  string
+	status int
+}
+
+// requestSeries is the latency histogram of a series; its count is also the number of requests.
+type requestSeries struct {
+	buckets []uint64 // Cumulative counts per bucket of durationBuckets.
+	count   uint64
+	sum     float64
+}
+
+// eventCounter is implemented by storage backends that can report how many events they keep.
+type eventCounter interface {
+	EventCount() int
+}
+
+// NewMetrics creates an empty set of metrics.
+func NewMetrics() *Metrics {
+	return &Metrics{requests: make(map[requestLabels]*requestSeries)}
+}
+
+// Observe records a finished request.
+func (m *Metrics) Observe(route string, status int, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	labels := requestLabels{route: route, status: status}
+	series, ok := m.requests[labels]
+	if !ok {
+		series = &requestSeries{buckets: make([]uint64, len(durationBuckets))}
+		m.requests[labels] = series
+	}
+
+	seconds := duration.Seconds()
+	for i, bound := range durationBuckets {
+		if seconds <= bound {
+			series.buckets[i]++
+		}
+	}
+	series.count++
+	series.sum += seconds
+}
+
+// Collect counts requests by the route pattern of router that matches them. It is meant to be placed
+// outside of the middlewares that may reject requests, so that rejected requests are counted too.
+func (m *Metrics) Collect(router *http.ServeMux) MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			m.inFlight.Add(1)
+			defer m.inFlight.Add(-1)
+
+			_, route := router.Handler(r)
+			if route == "" {
+				route = unmatchedRoute
+			}
+
+			recorder := &responseRecorder{ResponseWriter: w}
+			next.ServeHTTP(recorder, r)
+			m.Observe(route, recorder.Status(), time.Since(start))
+		})
+	}
+}
+
+// Expose writes the request metrics and the given gauges of stored events per backend in the Prometheus text format.
+func (m *Metrics) Expose(w io.Writer, storedEvents map[string]int) error {
+	var b strings.Builder
+
+	m.mu.Lock()
+	keys := make([]requestLabels, 0, len(m.requests))
+	for labels := range m.requests {
+		keys = append(keys, labels)
+	}
+	slices.SortFunc(keys, func(a, b requestLabels) int {
+		if c := strings.Compare(a.route, b.route); c != 0 {
+			return c
+		}
+		return a.status - b.status
+	})
+
+	b.WriteString("# HELP calendar_http_requests_total Number of HTTP requests by route and status.\n")
+	b.WriteString("# TYPE calendar_http_requests_total counter\n")
+	for _, labels := range keys {
+		fmt.Fprintf(&b, "calendar_http_requests_total{%s} %d\n", labels, m.requests[labels].count)
+	}
+
+	b.WriteString("# HELP calendar_http_request_duration_seconds Latency of HTTP requests by route and status.\n")
+	b.WriteString("# TYPE calendar_http_request_duration_seconds histogram\n")
+	for _, labels := range keys {
+		series := m.requests[labels]
+		for i, bound := range durationBuckets {
+			fmt.Fprintf(&b, "calendar_http_request_duration_seconds_bucket{%s,le=\"%s\"} %d\n",
+				labels, formatFloat(bound), series.buckets[i])
+		}
+		fmt.Fprintf(&b, "calendar_http_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, series.count)
+		fmt.Fprintf(&b, "calendar_http_request_duration_seconds_sum{%s} %s\n", labels, formatFloat(series.sum))
+		fmt.Fprintf(&b, "calendar_http_request_duration_seconds_count{%s} %d\n", labels, series.count)
+	}
+	m.mu.Unlock()
+
+	b.WriteString("# HELP calendar_http_requests_in_flight Number of HTTP requests being served.\n")
+	b.WriteString("# TYPE calendar_http_requests_in_flight gauge\n")
+	fmt.Fprintf(&b, "calendar_http_requests_in_flight %d\n", m.inFlight.Load())
+
+	backends := make([]string, 0, len(storedEvents))
+	for backend := range storedEvents {
+		backends = append(backends, backend)
+	}
+	slices.Sort(backends)
+	b.WriteString("# HELP calendar_events_stored Number of events kept by the storage backend.\n")
+	b.WriteString("# TYPE calendar_events_stored gauge\n")
+	for _, backend := range backends {
+		fmt.Fprintf(&b, "calendar_events_stored{backend=\"%s\"} %d\n", escapeLabel(backend), storedEvents[backend])
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// metricsHandler handles GET /metrics, exposing the collected metrics in the Prometheus text format.
+func (s *Server) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	// Checking the request method and Content-Type.
+	if !validateRequest(w, r, http.MethodGet) {
+		return
+	}
+
+	storedEvents := make(map[string]int)
+	if counter, ok := s.calendar.(eventCounter); ok {
+		storedEvents[s.config.Storage.Backend] = counter.EventCount()
+	}
+
+	// Return a successful response.
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := s.metrics.Expose(w, storedEvents); err != nil {
+		log.Println("Error writing response:", err)
+	}
+}
+
+// String formats the labels for the text exposition.
+func (l requestLabels) String() string {
+	return fmt.Sprintf("route=\"%s\",status=\"%d\"", escapeLabel(l.route), l.status)
+}
+
+// escapeLabel escapes a label value as the text exposition format requires.
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// formatFloat formats a sample value in the shortest form that parses back to it.
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
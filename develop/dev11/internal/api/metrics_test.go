@@ -0,0 +1,39 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	config := defaultConfig()
+	config.Auth.APIKeys = []string{"key:1"}
+	server, err := NewServer(config)
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+
+	do(server, http.MethodGet, "/events_for_day?user_id=1", "", "")
+	do(server, http.MethodGet, "/no_such_route", "", "")
+
+	w := do(server, http.MethodGet, "/metrics", "", "")
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Fatalf("status = %d, Content-Type = %q; metrics must be served without credentials",
+			w.Code, w.Header().Get("Content-Type"))
+	}
+
+	body := w.Body.String()
+	for _, want := range []string{
+		`calendar_http_requests_total{route="GET /events_for_day",status="401"} 1`,
+		`calendar_http_requests_total{route="unmatched",status="401"} 1`,
+		`calendar_http_request_duration_seconds_bucket{route="GET /events_for_day",status="401",le="+Inf"} 1`,
+		`calendar_http_request_duration_seconds_count{route="GET /events_for_day",status="401"} 1`,
+		"calendar_http_requests_in_flight 1",
+		`calendar_events_stored{backend="memory"} 0`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics do not contain %s:\n%s", want, body)
+		}
+	}
+}
@@ -1,27 +1,138 @@
 package api
 
 import (
-	"log"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
 	"net/http"
 	"time"
 )
 
+// RequestIDHeader carries the ID that ties together the logs and the response of a request.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength limits the length of request IDs accepted from clients.
+const maxRequestIDLength = 128
+
+// requestIDKey is the context key under which the request ID is stored.
+type requestIDKey struct{}
+
 // Middleware represents an HTTP middleware that wraps around a handler
-// to provide additional functionality, such as logging the request method.
+// to provide additional functionality: it assigns every request an ID and writes a structured access log entry.
 type Middleware struct {
-	next http.Handler // The next handler in the chain to be executed.
+	next   http.Handler // The next handler in the chain to be executed.
+	logger *slog.Logger // The access log.
 }
 
 // ServeHTTP implements the http.Handler interface, allowing Middleware
 // to intercept HTTP requests, log relevant information, and pass the
 // request to the next handler in the chain.
+// The request ID is taken from the X-Request-ID header or generated, and is echoed in the response header,
+// so utils.SendError can include it in error bodies.
 func (m *Middleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
-	m.next.ServeHTTP(w, r)
-	log.Printf("%s %s %s %s", r.Method, r.URL.Path, r.RemoteAddr, time.Since(start))
+
+	id := r.Header.Get(RequestIDHeader)
+	if !validRequestID(id) {
+		id = newRequestID()
+	}
+	w.Header().Set(RequestIDHeader, id)
+	r = r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id))
+
+	recorder := &responseRecorder{ResponseWriter: w}
+	m.next.ServeHTTP(recorder, r)
+
+	level := slog.LevelInfo
+	if recorder.Status() >= http.StatusInternalServerError {
+		level = slog.LevelError
+	}
+	m.logger.LogAttrs(r.Context(), level, "request",
+		slog.String("request_id", id),
+		slog.String("method", r.Method),
+		slog.String("path", r.URL.Path),
+		slog.String("remote_addr", r.RemoteAddr),
+		slog.Int("status", recorder.Status()),
+		slog.Int64("bytes", recorder.size),
+		slog.Duration("duration", time.Since(start)),
+	)
+}
+
+// NewMiddleware creates a new instance of Middleware with the specified next handler, writing the access log to logger.
+func NewMiddleware(next http.Handler, logger *slog.Logger) *Middleware {
+	return &Middleware{next: next, logger: logger}
+}
+
+// RequestID returns the ID of the request the context belongs to, or an empty string outside of a request.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// validRequestID reports whether a client-supplied request ID is non-empty, not too long and printable ASCII.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID generates a random 128-bit request ID.
+func newRequestID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// responseRecorder wraps a http.ResponseWriter to remember the status code and the size of the response.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	size   int64
+}
+
+// WriteHeader records the status code and passes it on.
+func (rw *responseRecorder) WriteHeader(statusCode int) {
+	if rw.status == 0 {
+		rw.status = statusCode
+	}
+	rw.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write records the size of the body and passes it on; the status defaults to 200 as in http.ResponseWriter.
+func (rw *responseRecorder) Write(b []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	n, err := rw.ResponseWriter.Write(b)
+	rw.size += int64(n)
+	return n, err
+}
+
+// Flush sends any buffered data to the client if the underlying writer supports it.
+func (rw *responseRecorder) Flush() {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer for http.ResponseController.
+func (rw *responseRecorder) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
 }
 
-// NewMiddleware creates a new instance of Middleware with the specified next handler.
-func NewMiddleware(next http.Handler) *Middleware {
-	return &Middleware{next: next}
+// Status returns the recorded status code; a handler that wrote nothing has implicitly responded with 200.
+func (rw *responseRecorder) Status() int {
+	if rw.status == 0 {
+		return http.StatusOK
+	}
+	return rw.status
 }
@@ -0,0 +1,207 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"dev11/internal/utils"
+)
+
+func TestMiddlewareAccessLog(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&logs, nil))
+	handler := NewMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if RequestID(r.Context()) != w.Header().Get(RequestIDHeader) {
+			t.Error("request ID in the context differs from the response header")
+		}
+		utils.SendError(w, http.ErrNoLocation, http.StatusNotFound)
+	}), logger)
+
+	tests := []struct {
+		name      string
+		incoming  string
+		propagate bool
+	}{
+		{"generated", "", false},
+		{"propagated", "abc-123", true},
+		{"invalid", "has space", false},
+	}
+
+	for _, test := range tests {
+		logs.Reset()
+		r := httptest.NewRequest(http.MethodGet, "/missing", nil)
+		if test.incoming != "" {
+			r.Header.Set(RequestIDHeader, test.incoming)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		id := w.Header().Get(RequestIDHeader)
+		if id == "" || (id == test.incoming) != test.propagate {
+			t.Errorf("%s: X-Request-ID = %q for incoming %q", test.name, id, test.incoming)
+		}
+
+		var body utils.ErrorResponse
+		if err := json.NewDecoder(w.Body).Decode(&body); err != nil || body.RequestID != id {
+			t.Errorf("%s: error body %+v (%v) does not carry request ID %q", test.name, body, err, id)
+		}
+
+		var entry struct {
+			RequestID string `json:"request_id"`
+			Method    string `json:"method"`
+			Status    int    `json:"status"`
+			Bytes     int    `json:"bytes"`
+		}
+		if err := json.Unmarshal(logs.Bytes(), &entry); err != nil {
+			t.Fatalf("%s: access log is not JSON: %v; %s", test.name, err, logs.Bytes())
+		}
+		if entry.RequestID != id || entry.Method != http.MethodGet || entry.Status != http.StatusNotFound || entry.Bytes == 0 {
+			t.Errorf("%s: access log entry = %+v", test.name, entry)
+		}
+	}
+}
+
+func TestChainOrder(t *testing.T) {
+	var order []string
+	mark := func(name string) MiddlewareFunc {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	handler := Chain(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		order = append(order, "handler")
+	}), mark("outer"), mark("inner"))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if got := strings.Join(order, ","); got != "outer,inner,handler" {
+		t.Errorf("order = %s, want outer,inner,handler", got)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	handler := Recover(logger)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic("boom")
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), `"error":"internal server error"`) {
+		t.Errorf("status = %d, body %s; want a 500 JSON error", w.Code, w.Body)
+	}
+}
+
+func TestCORS(t *testing.T) {
+	handler := CORS(CORSConfig{AllowedOrigins: []string{"https://app.example"}})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	tests := []struct {
+		name   string
+		method string
+		origin string
+		status int
+		allow  string
+	}{
+		{"same origin", http.MethodGet, "", http.StatusTeapot, ""},
+		{"allowed", http.MethodGet, "https://app.example", http.StatusTeapot, "https://app.example"},
+		{"other origin", http.MethodGet, "https://evil.example", http.StatusTeapot, ""},
+		{"preflight", http.MethodOptions, "https://app.example", http.StatusNoContent, "https://app.example"},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(test.method, "/api/v1/events", nil)
+		if test.origin != "" {
+			r.Header.Set("Origin", test.origin)
+		}
+		if test.method == http.MethodOptions {
+			r.Header.Set("Access-Control-Request-Method", http.MethodPatch)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if w.Code != test.status || w.Header().Get("Access-Control-Allow-Origin") != test.allow {
+			t.Errorf("%s: status = %d, Allow-Origin = %q; want %d, %q",
+				test.name, w.Code, w.Header().Get("Access-Control-Allow-Origin"), test.status, test.allow)
+		}
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	now := time.Date(2025, 1, 16, 10, 0, 0, 0, time.UTC)
+	limiter := NewRateLimiter(1, 2)
+	limiter.now = func() time.Time { return now }
+	handler := RateLimit(limiter)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	request := func(addr string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = addr
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	tests := []struct {
+		name    string
+		advance time.Duration
+		addr    string
+		status  int
+	}{
+		{"first", 0, "10.0.0.1:1000", http.StatusOK},
+		{"burst", 0, "10.0.0.1:1001", http.StatusOK},
+		{"exhausted", 0, "10.0.0.1:1002", http.StatusTooManyRequests},
+		{"other client", 0, "10.0.0.2:1000", http.StatusOK},
+		{"refilled", time.Second, "10.0.0.1:1003", http.StatusOK},
+		{"exhausted again", 0, "10.0.0.1:1004", http.StatusTooManyRequests},
+	}
+
+	for _, test := range tests {
+		now = now.Add(test.advance)
+		w := request(test.addr)
+		if w.Code != test.status {
+			t.Errorf("%s: status = %d, want %d", test.name, w.Code, test.status)
+		}
+		if test.status == http.StatusTooManyRequests && w.Header().Get("Retry-After") != "1" {
+			t.Errorf("%s: Retry-After = %q, want 1", test.name, w.Header().Get("Retry-After"))
+		}
+	}
+}
+
+func TestLimitBody(t *testing.T) {
+	server := newTestServer(t)
+	server.httpServer.Handler = Chain(server.router, LimitBody(64))
+
+	body := `{"user_id":1,"title":"` + strings.Repeat("x", 100) + `","date":"2025-01-16T10:00:00Z"}`
+	if w := do(server, http.MethodPost, "/create_event", "application/json", body); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusRequestEntityTooLarge)
+	}
+	if w := do(server, http.MethodPost, "/create_event", "application/json", `{"user_id":1,"title":"x","date":"2025-01-16T10:00:00Z"}`); w.Code != http.StatusOK {
+		t.Errorf("small body: status = %d; body %s", w.Code, w.Body)
+	}
+
+	// A chunked body declares no length and is only found too large while it is read.
+	chunked := map[string]string{
+		"application/json":                  body,
+		"application/x-www-form-urlencoded": "user_id=1&title=" + strings.Repeat("x", 100) + "&date=2025-01-16",
+	}
+	for contentType, body := range chunked {
+		r := httptest.NewRequest(http.MethodPost, "/create_event", io.NopCloser(strings.NewReader(body)))
+		r.ContentLength = -1
+		r.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		server.httpServer.Handler.ServeHTTP(w, r)
+		if w.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("chunked %s body: status = %d, want %d", contentType, w.Code, http.StatusRequestEntityTooLarge)
+		}
+	}
+}
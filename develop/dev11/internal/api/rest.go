@@ -0,0 +1,257 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"dev11/internal/calendar"
+	"dev11/internal/utils"
+)
+
+// eventsPath is the collection of events in the resource-oriented API.
+const eventsPath = "/api/v1/events"
+
+// listEventsHandler handles GET /api/v1/events. The user's events are filtered by the 'from' and 'to' range,
+// see rangeEvents, or by the day, week or month given by 'period' around 'date'. Without filters, all events are returned as stored.
+func (s *Server) listEventsHandler(w http.ResponseWriter, r *http.Request) {
+	// Checking the request method and Content-Type.
+	if !validateRequest(w, r, http.MethodGet) {
+		return
+	}
+
+	// Parsing the user ID, the page and the filters, then calling business logic.
+	userID, err := utils.ParseUserID(r)
+	if err != nil {
+		log.Println("Error parsing query:", err)
+		utils.SendError(w, err, http.StatusBadRequest)
+		return
+	}
+	options, err := utils.ParseListOptions(r)
+	if err != nil {
+		log.Println("Error parsing query:", err)
+		utils.SendError(w, err, http.StatusBadRequest)
+		return
+	}
+	events, err := s.filterEvents(r, userID)
+	if err != nil {
+		log.Println("Error parsing query:", err)
+		utils.SendError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	// Return a successful response.
+	if err = utils.SendEvents(w, calendar.Paginate(events, options)); err != nil {
+		log.Println("Error writing response:", err)
+		utils.SendError(w, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// filterEvents returns the user's events selected by the query parameters of listEventsHandler.
+func (s *Server) filterEvents(r *http.Request, userID int) ([]calendar.Event, error) {
+	query := r.URL.Query()
+	if query.Has("from") || query.Has("to") {
+		from, to, err := utils.ParseRangeParams(r, s.location)
+		if err != nil {
+			return nil, err
+		}
+		return s.rangeEvents(r, userID, from, to)
+	}
+
+	period := query.Get("period")
+	if period == "" {
+		return s.calendar.AllEvents(userID), nil
+	}
+	date, err := utils.ParseDateParam(r, "date", s.location)
+	if err != nil {
+		return nil, err
+	}
+	switch period {
+	case "day":
+		return s.calendar.DailyEvents(userID, date), nil
+	case "week":
+		return s.calendar.WeeklyEvents(userID, date), nil
+	case "month":
+		return s.calendar.MonthlyEvents(userID, date), nil
+	default:
+		return nil, fmt.Errorf("period %q is not one of day, week, month", period)
+	}
+}
+
+// postEventHandler handles POST /api/v1/events, creating an event from a form or JSON body.
+// It responds with 201 Created, the stored event and its Location.
+func (s *Server) postEventHandler(w http.ResponseWriter, r *http.Request) {
+	// Checking the request method and Content-Type.
+	if !validateRequest(w, r, http.MethodPost, utils.FormContentType, utils.JSONContentType) {
+		return
+	}
+
+	// Parsing and creating an event object.
+	event, err := utils.ParseEventParams(r, s.location)
+	if err != nil {
+		log.Println("Error parsing body:", err)
+		utils.SendError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	// Calling business logic.
+	if err = s.storage(r).CreateEvent(event); err != nil {
+		sendStorageError(w, err)
+		return
+	}
+
+	// Return a successful response.
+	w.Header().Set("Location", eventLocation(event))
+	if err = utils.SendEvent(w, *event, http.StatusCreated); err != nil {
+		log.Println("Error writing response:", err)
+		return
+	}
+}
+
+// getEventHandler handles GET /api/v1/events/{id}, returning the event as stored together with its ETag.
+func (s *Server) getEventHandler(w http.ResponseWriter, r *http.Request) {
+	// Checking the request method and Content-Type.
+	if !validateRequest(w, r, http.MethodGet) {
+		return
+	}
+
+	// Parsing the user ID and the event ID.
+	userID, ID, err := parseResourceKey(r)
+	if err != nil {
+		log.Println("Error parsing request:", err)
+		utils.SendError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	// Calling business logic.
+	event, err := s.calendar.GetEvent(userID, ID)
+	if err != nil {
+		sendStorageError(w, err)
+		return
+	}
+
+	// Return a successful response.
+	if err = utils.SendEvent(w, *event, http.StatusOK); err != nil {
+		log.Println("Error writing response:", err)
+		return
+	}
+}
+
+// putEventHandler handles PUT /api/v1/events/{id}, replacing all details of an existing event,
+// such as its title, dates, recurrence, reminders and attendees, with those of the body. Exceptions of the old recurrence are dropped.
+// The If-Match header makes the update conditional.
+func (s *Server) putEventHandler(w http.ResponseWriter, r *http.Request) {
+	// Checking the request method and Content-Type.
+	if !validateRequest(w, r, http.MethodPut, utils.FormContentType, utils.JSONContentType) {
+		return
+	}
+
+	// Parsing the event ID from the path and the new event from the body.
+	ID, err := utils.ParsePathID(r)
+	if err != nil {
+		utils.SendError(w, err, http.StatusBadRequest)
+		return
+	}
+	event, err := utils.ParseEventParams(r, s.location)
+	if err == nil && event.ID != 0 && event.ID != ID {
+		err = errors.New("id in the body does not match the path")
+	}
+	if err != nil {
+		log.Println("Error parsing body:", err)
+		utils.SendError(w, err, http.StatusBadRequest)
+		return
+	}
+	version, err := utils.ParseIfMatch(r)
+	if err != nil {
+		utils.SendError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	// Calling business logic.
+	patch := calendar.Patch{
+		Title:            &event.Title,
+		Description:      &event.Description,
+		Location:         &event.Location,
+		Date:             &event.Date,
+		End:              event.End,
+		RemoveEnd:        event.End == nil,
+		Recurrence:       event.Recurrence,
+		RemoveRecurrence: event.Recurrence == nil,
+		Reminders:        &event.Reminders,
+		Attendees:        &event.Attendees,
+		Status:           &event.Status,
+	}
+	updated, err := s.storage(r).UpdateEvent(event.UserID, ID, patch, version)
+	if err != nil {
+		sendStorageError(w, err)
+		return
+	}
+
+	// Return a successful response.
+	if err = utils.SendEvent(w, *updated, http.StatusOK); err != nil {
+		log.Println("Error writing response:", err)
+		return
+	}
+}
+
+// deleteEventByIDHandler handles DELETE /api/v1/events/{id}, responding with 204 No Content.
+func (s *Server) deleteEventByIDHandler(w http.ResponseWriter, r *http.Request) {
+	// Checking the request method and Content-Type.
+	if !validateRequest(w, r, http.MethodDelete) {
+		return
+	}
+
+	// Parsing the user ID and the event ID.
+	userID, ID, err := parseResourceKey(r)
+	if err != nil {
+		log.Println("Error parsing request:", err)
+		utils.SendError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	// Calling business logic.
+	if _, err = s.storage(r).DeleteEvent(userID, ID); err != nil {
+		sendStorageError(w, err)
+		return
+	}
+
+	// Return a successful response.
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// parseResourceKey parses the 'user_id' query parameter and the event ID from the path.
+func parseResourceKey(r *http.Request) (int, int, error) {
+	userID, err := utils.ParseUserID(r)
+	if err != nil {
+		return 0, 0, err
+	}
+	ID, err := utils.ParsePathID(r)
+	if err != nil {
+		return 0, 0, err
+	}
+	return userID, ID, nil
+}
+
+// eventLocation returns the URL of the event in the resource-oriented API.
+func eventLocation(event *calendar.Event) string {
+	return fmt.Sprintf("%s/%d?user_id=%d", eventsPath, event.ID, event.UserID)
+}
+
+// sendStorageError maps an error of the storage to the status code of the resource-oriented API.
+func sendStorageError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, calendar.ErrNoSuchEvent):
+		utils.SendError(w, err, http.StatusNotFound)
+	case errors.Is(err, calendar.ErrEventExists):
+		utils.SendError(w, err, http.StatusConflict)
+	case errors.Is(err, calendar.ErrVersionMismatch):
+		utils.SendError(w, err, http.StatusPreconditionFailed)
+	case errors.Is(err, calendar.ErrInvalidEvent):
+		utils.SendError(w, err, http.StatusBadRequest)
+	default:
+		log.Println("Error saving data:", err)
+		utils.SendError(w, errors.New("failed to save event"), http.StatusInternalServerError)
+	}
+}
@@ -1,53 +1,253 @@
 package api
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"dev11/internal/calendar"
+	"dev11/internal/reminder"
 )
 
-// Storage defines an interface for managing calendar events,
-// providing methods to create, update, delete, and retrieve events on a daily, weekly, or monthly basis.
+// Storage defines an interface for managing calendar events. Every event belongs to a user, and each method
+// only sees the events of the given user. Listings are sorted chronologically and expand recurring events
+// into their occurrences. Backends may also implement optional capabilities, such as HealthChecker,
+// which the server detects by type assertion.
 type Storage interface {
-	CreateEvent(event *calendar.Event)
-	UpdateEvent(ID int, Title string, Date time.Time) error
-	DeleteEvent(ID int) (*calendar.Event, error)
-	DailyEvents() []calendar.Event
-	WeeklyEvents() []calendar.Event
-	MonthlyEvents() []calendar.Event
+	CreateEvent(event *calendar.Event) error
+	// GetEvent returns the event as stored, without expanding its recurrence.
+	GetEvent(userID, ID int) (*calendar.Event, error)
+	// UpdateEvent changes only the fields set in the patch and, given a non-zero version,
+	// fails if the event has changed since.
+	UpdateEvent(userID, ID int, patch calendar.Patch, version int) (*calendar.Event, error)
+	DeleteEvent(userID, ID int) (*calendar.Event, error)
+	// SetException cancels or moves a single occurrence of a recurring event.
+	SetException(userID, ID int, exception calendar.Exception) error
+	// DailyEvents, WeeklyEvents and MonthlyEvents return the events of the day, week or month around date.
+	DailyEvents(userID int, date time.Time) []calendar.Event
+	WeeklyEvents(userID int, date time.Time) []calendar.Event
+	MonthlyEvents(userID int, date time.Time) []calendar.Event
+	// EventsInRange returns the events starting in [from, to), EventsOverlapping those overlapping it.
+	EventsInRange(userID int, from, to time.Time) []calendar.Event
+	EventsOverlapping(userID int, from, to time.Time) []calendar.Event
+	// Overlapping returns the events that collide with the given one.
+	Overlapping(event calendar.Event) []calendar.Event
+	// AllEvents returns every event of the user as stored.
+	AllEvents(userID int) []calendar.Event
+	// Close releases the storage when the server stops.
+	Close() error
 }
 
 // Server represents the main application server, encapsulating
-// the configuration, HTTP router, middleware, and storage for calendar events.
+// the configuration, HTTP router, middleware, metrics, and storage for calendar events.
 // It is responsible for handling incoming requests and managing the application’s lifecycle.
 type Server struct {
 	config     *Config
+	location   *time.Location // Time zone of requests that do not specify one.
 	router     *http.ServeMux
-	middleware *Middleware
+	middleware []MiddlewareFunc
+	metrics    *Metrics
+	changes    *changeLog
 	calendar   Storage
+	httpServer *http.Server
+	draining   atomic.Bool // Set once the server starts shutting down.
+	booking    sync.Mutex  // Serializes the writes that reject overlapping events.
+
+	tasks          []func(ctx context.Context) // Background tasks run while the server is serving.
+	startTasks     sync.Once
+	stopTasks      context.CancelFunc
+	tasksCtx       context.Context
+	tasksWaitGroup sync.WaitGroup
 }
 
 // NewServer initializes a new Server instance with the provided configuration,
-// setting up the HTTP router and middleware, and creating a new calendar storage instance.
-func NewServer(config *Config) *Server {
+// setting up the HTTP router, middleware and the underlying http.Server with the configured timeouts,
+// and opening the configured calendar storage. The access log is written to the default slog logger.
+func NewServer(config *Config) (*Server, error) {
+	location, err := time.LoadLocation(config.TimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time zone %q: %w", config.TimeZone, err)
+	}
+
+	storage, err := newStorage(config.Storage)
+	if err != nil {
+		return nil, err
+	}
+
 	router := http.NewServeMux()
 
-	return &Server{
-		config:     config,
-		router:     router,
-		middleware: NewMiddleware(router),
-		calendar:   calendar.NewCalendar(),
+	s := &Server{
+		config:   config,
+		location: location,
+		router:   router,
+		metrics:  NewMetrics(),
+		changes:  newChangeLog(config.Stream.LogSize),
+		calendar: storage,
+	}
+	s.middleware = s.newMiddlewareChain(slog.Default())
+	s.tasksCtx, s.stopTasks = context.WithCancel(context.Background())
+	if store, ok := storage.(reminder.Store); ok {
+		notifier := config.Reminders.NewNotifier(slog.Default())
+		scheduler := reminder.NewScheduler(store, notifier, config.Reminders.Interval, slog.Default())
+		s.tasks = append(s.tasks, scheduler.Run)
+	}
+	if bin, ok := s.storageAs(systemActor).(trashBin); ok {
+		s.tasks = append(s.tasks, func(ctx context.Context) { s.purgeTrash(ctx, bin) })
+	}
+	s.httpServer = &http.Server{
+		Addr:              config.AddrPort,
+		Handler:           Chain(router, s.middleware...),
+		ReadTimeout:       config.Timeouts.Read,
+		ReadHeaderTimeout: config.Timeouts.ReadHeader,
+		WriteTimeout:      config.Timeouts.Write,
+		IdleTimeout:       config.Timeouts.Idle,
+	}
+	s.httpServer.RegisterOnShutdown(s.changes.close)
+	if notifier, ok := storage.(changeNotifier); ok {
+		notifier.OnChange(s.changes.append)
+	}
+	s.configureRouter()
+
+	return s, nil
+}
+
+// publicPaths are served without authentication, so that monitoring and probes need no credentials.
+var publicPaths = []string{"/metrics", "/healthz", "/readyz"}
+
+// newMiddlewareChain builds the middlewares enabled in the configuration, from the outermost one:
+// the access log, metrics, panic recovery, CORS, the rate limit, the body size limit and authentication.
+func (s *Server) newMiddlewareChain(logger *slog.Logger) []MiddlewareFunc {
+	config := s.config
+	chain := []MiddlewareFunc{AccessLog(logger), s.metrics.Collect(s.router), Recover(logger)}
+	if len(config.CORS.AllowedOrigins) > 0 {
+		chain = append(chain, CORS(config.CORS))
+	}
+	if config.RateLimit.RequestsPerSecond > 0 {
+		chain = append(chain, RateLimit(NewRateLimiter(config.RateLimit.RequestsPerSecond, config.RateLimit.Burst)))
+	}
+	chain = append(chain, LimitBody(config.MaxBodyBytes))
+	if config.Auth.Enabled() {
+		isPublic := func(r *http.Request) bool { return slices.Contains(publicPaths, r.URL.Path) }
+		chain = append(chain, Unless(isPublic, Authenticate(config.Auth.Authenticators()...)))
+	}
+	return chain
+}
+
+// newStorage creates the storage backend selected in the configuration.
+func newStorage(config StorageConfig) (Storage, error) {
+	var storage *calendar.Calendar
+	switch config.Backend {
+	case "", "memory":
+		storage = calendar.NewCalendar()
+	case "file":
+		log.Println("Using file storage in", config.Dir)
+		var err error
+		if storage, err = calendar.OpenCalendar(config.Dir, config.SnapshotEvery); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", config.Backend)
+	}
+
+	if err := storage.LimitAudit(config.AuditLimit); err != nil {
+		_ = storage.Close()
+		return nil, err
 	}
+	return auditedCalendar{storage}, nil
 }
 
 // Start begins listening for incoming HTTP requests on the configured address and port,
-// logging the server's start message and configuring the router for handling requests.
+// logging the server's start message. It blocks until the server is shut down.
 func (s *Server) Start() error {
-	log.Println("Starting API Server on port", s.config.AddrPort)
-	s.configureRouter()
-	return http.ListenAndServe(s.config.AddrPort, s.middleware)
+	listener, err := net.Listen("tcp", s.config.AddrPort)
+	if err != nil {
+		return err
+	}
+	return s.Serve(listener)
+}
+
+// Serve accepts incoming HTTP requests on the listener until the server is shut down,
+// which lets tests run the server on an ephemeral port. It serves HTTPS if TLS is configured.
+// After a shutdown it returns nil. The first call also starts the background tasks, such as the reminder scheduler.
+func (s *Server) Serve(listener net.Listener) error {
+	s.startTasks.Do(func() {
+		for _, task := range s.tasks {
+			s.tasksWaitGroup.Add(1)
+			go func() {
+				defer s.tasksWaitGroup.Done()
+				task(s.tasksCtx)
+			}()
+		}
+	})
+
+	var err error
+	if tls := s.config.TLS; tls.CertFile != "" {
+		log.Println("Starting API Server with TLS on", listener.Addr())
+		err = s.httpServer.ServeTLS(listener, tls.CertFile, tls.KeyFile)
+	} else {
+		log.Println("Starting API Server on", listener.Addr())
+		err = s.httpServer.Serve(listener)
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Shutdown marks the server as not ready and keeps serving for the configured shutdown delay, or until ctx expires,
+// then stops accepting new connections, waits for in-flight requests to complete until ctx expires,
+// stops the background tasks and then closes the storage.
+func (s *Server) Shutdown(ctx context.Context) error {
+	log.Println("Shutting down API Server")
+	s.draining.Store(true)
+	if delay := s.config.Timeouts.ShutdownDelay; delay > 0 {
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+		}
+	}
+	err := s.httpServer.Shutdown(ctx)
+	s.stopTasks()
+	s.tasksWaitGroup.Wait()
+	if closeErr := s.calendar.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Run starts the server and shuts it down gracefully once ctx is cancelled, for example on SIGINT or SIGTERM,
+// giving in-flight requests the configured shutdown timeout to complete after the shutdown delay.
+func (s *Server) Run(ctx context.Context) error {
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- s.Start()
+	}()
+
+	select {
+	case err := <-errCh:
+		s.stopTasks()
+		s.tasksWaitGroup.Wait()
+		_ = s.calendar.Close()
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.config.Timeouts.ShutdownDelay+s.config.Timeouts.Shutdown)
+	defer cancel()
+	if err := s.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("failed to shut down gracefully: %w", err)
+	}
+	return <-errCh
 }
 
 // configureRouter sets up the HTTP routes for the Server,
@@ -56,8 +256,34 @@ func (s *Server) configureRouter() {
 	s.router.HandleFunc("POST /create_event", s.createEventHandler)
 	s.router.HandleFunc("POST /update_event", s.updateEventHandler)
 	s.router.HandleFunc("POST /delete_event", s.deleteEventHandler)
+	s.router.HandleFunc("POST /events/batch", s.batchHandler)
+	s.router.HandleFunc("POST /restore_event", s.restoreEventHandler)
+	s.router.HandleFunc("PATCH /events/{id}", s.patchEventHandler)
+	s.router.HandleFunc("POST /cancel_occurrence", s.cancelOccurrenceHandler)
+	s.router.HandleFunc("POST /move_occurrence", s.moveOccurrenceHandler)
 
 	s.router.HandleFunc("GET /events_for_day", s.getDailyEventHandler)
 	s.router.HandleFunc("GET /events_for_week", s.getWeeklyEventHandler)
 	s.router.HandleFunc("GET /events_for_month", s.getMonthlyEventHandler)
+	s.router.HandleFunc("GET /events_in_range", s.getRangeEventHandler)
+	s.router.HandleFunc("GET /trash", s.trashHandler)
+	s.router.HandleFunc("GET /free_slots", s.freeSlotsHandler)
+	s.router.HandleFunc("GET /events/stream", s.streamHandler)
+	s.router.HandleFunc("GET /events/{id}/history", s.historyHandler)
+	s.router.HandleFunc("GET /audit", s.auditHandler)
+
+	s.router.HandleFunc("GET /export.ics", s.exportHandler)
+	s.router.HandleFunc("POST /import", s.importHandler)
+
+	s.router.HandleFunc("GET /metrics", s.metricsHandler)
+	s.router.HandleFunc("GET /healthz", s.healthHandler)
+	s.router.HandleFunc("GET /readyz", s.readyHandler)
+
+	// The resource-oriented API shares the storage with the routes above.
+	s.router.HandleFunc("GET /api/v1/events", s.listEventsHandler)
+	s.router.HandleFunc("POST /api/v1/events", s.postEventHandler)
+	s.router.HandleFunc("GET /api/v1/events/{id}", s.getEventHandler)
+	s.router.HandleFunc("PUT /api/v1/events/{id}", s.putEventHandler)
+	s.router.HandleFunc("PATCH /api/v1/events/{id}", s.patchEventHandler)
+	s.router.HandleFunc("DELETE /api/v1/events/{id}", s.deleteEventByIDHandler)
 }
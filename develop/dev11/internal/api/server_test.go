@@ -0,0 +1,130 @@
+package api
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+// startServer runs a server with the given configuration on an ephemeral port
+// and returns its base URL together with a function that shuts it down.
+func startServer(t *testing.T, config *Config) (*Server, string, func()) {
+	t.Helper()
+
+	server, err := NewServer(config)
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- server.Serve(listener)
+	}()
+
+	stop := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			t.Errorf("Shutdown failed: %v", err)
+		}
+		if err := <-done; err != nil {
+			t.Errorf("Serve returned %v after shutdown, want nil", err)
+		}
+	}
+	return server, "http://" + listener.Addr().String(), stop
+}
+
+func TestServerShutdown(t *testing.T) {
+	_, url, stop := startServer(t, defaultConfig())
+
+	resp, err := http.Get(url + "/events_for_day?user_id=1")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	stop()
+
+	if _, err = http.Get(url + "/events_for_day?user_id=1"); err == nil {
+		t.Error("server still accepts requests after shutdown")
+	}
+}
+
+func TestHealthAndReadiness(t *testing.T) {
+	config := defaultConfig()
+	config.Storage.Backend = "file"
+	config.Storage.Dir = t.TempDir()
+	config.Auth.APIKeys = []string{"key:1"}
+	server, err := NewServer(config)
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+
+	steps := []struct {
+		name    string
+		prepare func()
+		path    string
+		status  int
+	}{
+		{"alive", nil, "/healthz", http.StatusOK},
+		{"ready", nil, "/readyz", http.StatusOK},
+		{"storage gone", func() { _ = os.RemoveAll(config.Storage.Dir) }, "/readyz", http.StatusServiceUnavailable},
+		{"still alive", nil, "/healthz", http.StatusOK},
+		{"storage back", func() { _ = os.MkdirAll(config.Storage.Dir, 0o755) }, "/readyz", http.StatusOK},
+	}
+
+	for _, step := range steps {
+		if step.prepare != nil {
+			step.prepare()
+		}
+		if w := do(server, http.MethodGet, step.path, "", ""); w.Code != step.status {
+			t.Errorf("%s: %s status = %d, want %d; body %s", step.name, step.path, w.Code, step.status, w.Body)
+		}
+	}
+}
+
+func TestReadinessDuringShutdown(t *testing.T) {
+	config := defaultConfig()
+	config.Timeouts.ShutdownDelay = 300 * time.Millisecond
+	_, url, stop := startServer(t, config)
+
+	stopped := make(chan struct{})
+	go func() {
+		stop()
+		close(stopped)
+	}()
+
+	// The server keeps answering for the shutdown delay, failing its readiness check.
+	status := http.StatusOK
+	for deadline := time.Now().Add(config.Timeouts.ShutdownDelay); status == http.StatusOK && time.Now().Before(deadline); {
+		resp, err := http.Get(url + "/readyz")
+		if err != nil {
+			t.Fatalf("readiness probe failed during the shutdown delay: %v", err)
+		}
+		_ = resp.Body.Close()
+		status = resp.StatusCode
+	}
+	if status != http.StatusServiceUnavailable {
+		t.Errorf("/readyz status = %d during shutdown, want %d", status, http.StatusServiceUnavailable)
+	}
+	if resp, err := http.Get(url + "/healthz"); err != nil {
+		t.Errorf("liveness probe failed during the shutdown delay: %v", err)
+	} else {
+		_ = resp.Body.Close()
+	}
+
+	<-stopped
+	if _, err := http.Get(url + "/readyz"); err == nil {
+		t.Error("server still accepts requests after shutdown")
+	}
+}
@@ -0,0 +1,222 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"dev11/internal/auth"
+	"dev11/internal/calendar"
+	"dev11/internal/utils"
+)
+
+// changeNotifier is an optional capability of a Storage backend: it reports every change of an event
+// to the registered listeners. Without it, the change stream stays silent.
+type changeNotifier interface {
+	OnChange(listener func(calendar.Change))
+}
+
+// changeLog keeps the latest changes in memory, so that stream clients can catch up after a reconnect,
+// and wakes up the streams waiting for new changes. Entries are numbered from 1; the numbers are only
+// meaningful within the same epoch, which is unique to every run of the server.
+type changeLog struct {
+	mu      sync.Mutex
+	epoch   string
+	entries []logEntry // Oldest first, at most size entries.
+	size    int
+	lastID  uint64
+	waiters map[chan struct{}]struct{}
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// logEntry is a change together with its number in the change log.
+type logEntry struct {
+	id     uint64
+	change calendar.Change
+}
+
+// newChangeLog creates a change log that keeps the latest size changes.
+func newChangeLog(size int) *changeLog {
+	return &changeLog{
+		epoch:   strconv.FormatInt(time.Now().UnixNano(), 36),
+		size:    size,
+		waiters: make(map[chan struct{}]struct{}),
+		closed:  make(chan struct{}),
+	}
+}
+
+// append adds a change to the log, dropping the oldest one if the log is full, and wakes up the waiting streams.
+func (l *changeLog) append(change calendar.Change) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.lastID++
+	l.entries = append(l.entries, logEntry{id: l.lastID, change: change})
+	if len(l.entries) > l.size {
+		l.entries = append(l.entries[:0:0], l.entries[len(l.entries)-l.size:]...)
+	}
+
+	for wake := range l.waiters {
+		select {
+		case wake <- struct{}{}:
+		default: // The stream has a wake-up pending already.
+		}
+	}
+}
+
+// subscribe returns a channel that receives a value whenever changes are appended, and a function to unsubscribe.
+func (l *changeLog) subscribe() (<-chan struct{}, func()) {
+	wake := make(chan struct{}, 1)
+	l.mu.Lock()
+	l.waiters[wake] = struct{}{}
+	l.mu.Unlock()
+
+	return wake, func() {
+		l.mu.Lock()
+		delete(l.waiters, wake)
+		l.mu.Unlock()
+	}
+}
+
+// last returns the number of the latest change.
+func (l *changeLog) last() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.lastID
+}
+
+// since returns the changes made after the change numbered id. It reports false if some of them
+// have already been dropped from the log, or if id is unknown.
+func (l *changeLog) since(id uint64) ([]logEntry, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if id > l.lastID {
+		return nil, false
+	}
+	oldest := l.lastID - uint64(len(l.entries)) + 1
+	if id+1 < oldest {
+		return nil, false
+	}
+	return append([]logEntry(nil), l.entries[id+1-oldest:]...), true
+}
+
+// eventID formats the SSE event ID of the change numbered id.
+func (l *changeLog) eventID(id uint64) string {
+	return l.epoch + "-" + strconv.FormatUint(id, 10)
+}
+
+// parseEventID returns the number of the change with the given SSE event ID. It reports false
+// if the ID is malformed or comes from another run of the server.
+func (l *changeLog) parseEventID(eventID string) (uint64, bool) {
+	epoch, number, ok := strings.Cut(eventID, "-")
+	if !ok || epoch != l.epoch {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(number, 10, 64)
+	return id, err == nil
+}
+
+// close ends all streams, so that they do not hold up a graceful shutdown.
+func (l *changeLog) close() {
+	l.closeOnce.Do(func() { close(l.closed) })
+}
+
+// streamHandler handles GET /events/stream, pushing every create, update and delete as a Server-Sent Event
+// whose type is the type of the change and whose data is the change in JSON. The stream is limited to the user
+// given by 'user_id', or to the authenticated user; without either it carries the changes of all users.
+// A client reconnecting with the Last-Event-ID header, or the 'last_event_id' parameter, receives the changes
+// it missed; if they are no longer in the change log, it receives a 'reset' event and should reload its data.
+func (s *Server) streamHandler(w http.ResponseWriter, r *http.Request) {
+	// Checking the request method and Content-Type.
+	if !validateRequest(w, r, http.MethodGet) {
+		return
+	}
+
+	// Parsing the user filter.
+	userID := 0
+	if _, ok := auth.FromContext(r.Context()); ok || r.URL.Query().Has("user_id") {
+		var err error
+		if userID, err = utils.ParseUserID(r); err != nil {
+			log.Println("Error parsing query:", err)
+			utils.SendError(w, err, http.StatusBadRequest)
+			return
+		}
+	}
+
+	// The stream outlives the write timeout of the server.
+	controller := http.NewResponseController(w)
+	_ = controller.SetWriteDeadline(time.Time{})
+
+	wake, unsubscribe := s.changes.subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	cursor := s.changes.last()
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+	if lastEventID != "" {
+		if id, ok := s.changes.parseEventID(lastEventID); ok {
+			cursor = id
+		} else if _, err := fmt.Fprint(w, "event: reset\ndata: {}\n\n"); err != nil {
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(s.config.Stream.Heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		entries, ok := s.changes.since(cursor)
+		if !ok {
+			entries, cursor = nil, s.changes.last()
+			if _, err := fmt.Fprint(w, "event: reset\ndata: {}\n\n"); err != nil {
+				return
+			}
+		}
+		for _, entry := range entries {
+			cursor = entry.id
+			if userID != 0 && entry.change.Event.UserID != userID {
+				continue
+			}
+			data, err := json.Marshal(entry.change)
+			if err != nil {
+				log.Println("Error encoding change:", err)
+				continue
+			}
+			_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", s.changes.eventID(entry.id), entry.change.Type, data)
+			if err != nil {
+				return
+			}
+		}
+		if err := controller.Flush(); err != nil {
+			return
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.changes.closed:
+			return
+		case <-wake:
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		}
+	}
+}
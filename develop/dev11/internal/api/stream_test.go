@@ -0,0 +1,120 @@
+package api
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sseEvent is a Server-Sent Event read from a stream.
+type sseEvent struct {
+	id, name, data string
+}
+
+// openStream connects to the change stream and returns the events it receives.
+func openStream(t *testing.T, url, lastEventID string) (<-chan sseEvent, func()) {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("status = %d, Content-Type = %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	events := make(chan sseEvent, 16)
+	go func() {
+		defer close(events)
+		scanner := bufio.NewScanner(resp.Body)
+		var event sseEvent
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case line == "":
+				if event.name != "" {
+					events <- event
+				}
+				event = sseEvent{}
+			case strings.HasPrefix(line, "id: "):
+				event.id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				event.name = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				event.data = strings.TrimPrefix(line, "data: ")
+			}
+		}
+	}()
+	return events, func() { _ = resp.Body.Close() }
+}
+
+// expectEvents reads the named events from the stream, failing on anything else.
+func expectEvents(t *testing.T, events <-chan sseEvent, names ...string) []sseEvent {
+	t.Helper()
+
+	var received []sseEvent
+	for _, name := range names {
+		select {
+		case event := <-events:
+			if event.name != name {
+				t.Fatalf("event = %+v, want %s", event, name)
+			}
+			received = append(received, event)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for %s", name)
+		}
+	}
+	return received
+}
+
+func TestChangeStream(t *testing.T) {
+	_, url, stop := startServer(t, defaultConfig())
+	defer stop()
+
+	events, closeStream := openStream(t, url+"/events/stream?user_id=1", "")
+	defer closeStream()
+
+	post := func(target, body string) {
+		resp, err := http.Post(url+target, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: status = %d", target, resp.StatusCode)
+		}
+	}
+	post("/create_event", `{"user_id":2,"title":"Other user","date":"2025-01-16T10:00:00Z"}`)
+	post("/create_event", `{"user_id":1,"title":"Standup","date":"2025-01-16T10:00:00Z"}`)
+	post("/update_event", `{"user_id":1,"id":1,"title":"Retro"}`)
+	post("/delete_event", `{"user_id":1,"id":1}`)
+
+	received := expectEvents(t, events, "create", "update", "delete")
+	if !strings.Contains(received[0].data, `"title":"Standup"`) || !strings.Contains(received[1].data, `"title":"Retro"`) {
+		t.Errorf("unexpected change data: %+v", received)
+	}
+
+	// Resuming after the create replays the rest.
+	resumed, closeResumed := openStream(t, url+"/events/stream?user_id=1", received[0].id)
+	defer closeResumed()
+	replayed := expectEvents(t, resumed, "update", "delete")
+	if replayed[1].id != received[2].id {
+		t.Errorf("replayed IDs %s, want %s", replayed[1].id, received[2].id)
+	}
+
+	// An ID from another run of the server cannot be resumed from.
+	stale, closeStale := openStream(t, url+"/events/stream", "0-1")
+	defer closeStale()
+	expectEvents(t, stale, "reset")
+}
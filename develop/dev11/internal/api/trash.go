@@ -0,0 +1,121 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"dev11/internal/calendar"
+	"dev11/internal/utils"
+)
+
+// trashBin is implemented by storage backends whose DeleteEvent moves events to a trash they can be restored from.
+type trashBin interface {
+	Trash(userID int) []calendar.Event
+	RestoreEvent(userID, ID int) (*calendar.Event, error)
+	PurgeTrash(before time.Time) (int, error)
+}
+
+// errNoTrash is returned when the storage deletes events for good.
+var errNoTrash = errors.New("the storage does not keep deleted events")
+
+// trashHandler handles GET /trash, returning the user's deleted events that can still be restored, with their
+// deletion times. The listing can be paged, sorted and filtered like the other listings.
+func (s *Server) trashHandler(w http.ResponseWriter, r *http.Request) {
+	// Checking the request method and Content-Type.
+	if !validateRequest(w, r, http.MethodGet) {
+		return
+	}
+
+	// Parsing the user ID and the page.
+	userID, err := utils.ParseUserID(r)
+	if err != nil {
+		log.Println("Error parsing query:", err)
+		utils.SendError(w, err, http.StatusBadRequest)
+		return
+	}
+	options, err := utils.ParseListOptions(r)
+	if err != nil {
+		log.Println("Error parsing query:", err)
+		utils.SendError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	// Calling business logic.
+	bin, ok := s.calendar.(trashBin)
+	if !ok {
+		utils.SendError(w, errNoTrash, http.StatusNotImplemented)
+		return
+	}
+	events := bin.Trash(userID)
+
+	// Return a successful response.
+	if err = utils.SendEvents(w, calendar.Paginate(events, options)); err != nil {
+		log.Println("Error writing response:", err)
+		utils.SendError(w, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// restoreEventHandler handles POST /restore_event, moving the event given by 'user_id' and 'id'
+// back from the trash.
+func (s *Server) restoreEventHandler(w http.ResponseWriter, r *http.Request) {
+	// Checking the request method and Content-Type.
+	if !validateRequest(w, r, http.MethodPost, utils.FormContentType, utils.JSONContentType) {
+		return
+	}
+
+	// Parse and get the user ID and the event ID.
+	userID, ID, err := utils.ParseEventKey(r)
+	if err != nil {
+		log.Println("Error parsing form:", err)
+		utils.SendError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	// Calling business logic.
+	bin, ok := s.storage(r).(trashBin)
+	if !ok {
+		utils.SendError(w, errNoTrash, http.StatusNotImplemented)
+		return
+	}
+	restored, err := bin.RestoreEvent(userID, ID)
+	if err != nil {
+		log.Println("Error restoring data:", err)
+		utils.SendError(w, err, http.StatusServiceUnavailable)
+		return
+	}
+
+	// Return a successful response.
+	err = utils.SendResult(w, fmt.Sprintf("event №%d [%s, %v] restored", restored.ID, restored.Title, restored.Date))
+	if err != nil {
+		log.Println("Error writing response:", err)
+		utils.SendError(w, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// purgeTrash removes the events that have been in the trash longer than the configured retention,
+// checking every purge interval until ctx is cancelled.
+func (s *Server) purgeTrash(ctx context.Context, bin trashBin) {
+	ticker := time.NewTicker(s.config.Trash.PurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := bin.PurgeTrash(time.Now().Add(-s.config.Trash.Retention))
+		if err != nil {
+			log.Println("Error purging trash:", err)
+		} else if purged > 0 {
+			log.Printf("Purged %d events from the trash", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,77 @@
+// Package auth authenticates the clients of the calendar API with static API keys
+// or with HMAC-signed bearer tokens, and carries the authenticated principal in the request context.
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// Errors returned by authenticators. ErrNoCredentials means the request does not carry the kind of credentials
+// the authenticator checks, so another authenticator may still accept it.
+var (
+	ErrNoCredentials      = errors.New("no credentials")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// Principal is an authenticated client. Every client acts on behalf of a single calendar user.
+type Principal struct {
+	UserID int
+	Method string // How the client was authenticated: "api_key" or "token".
+}
+
+// Authenticator checks the credentials of a request and returns the principal they belong to.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+// principalKey is the context key under which the principal is stored.
+type principalKey struct{}
+
+// NewContext returns a copy of ctx carrying the principal.
+func NewContext(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// FromContext returns the principal stored in ctx, if any.
+func FromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(*Principal)
+	return principal, ok
+}
+
+// APIKeyHeader is the header that carries an API key.
+const APIKeyHeader = "X-API-Key"
+
+// APIKeys authenticates requests by a static key sent in the X-API-Key header. It maps every key to its user.
+type APIKeys map[string]int
+
+// Authenticate looks the key of the request up, comparing keys in constant time.
+func (keys APIKeys) Authenticate(r *http.Request) (*Principal, error) {
+	key := r.Header.Get(APIKeyHeader)
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+
+	userID := 0
+	for known, owner := range keys {
+		if subtle.ConstantTimeCompare([]byte(known), []byte(key)) == 1 {
+			userID = owner
+		}
+	}
+	if userID == 0 {
+		return nil, ErrInvalidCredentials
+	}
+	return &Principal{UserID: userID, Method: "api_key"}, nil
+}
+
+// bearerToken returns the token of the "Authorization: Bearer" header, or an empty string.
+func bearerToken(r *http.Request) string {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
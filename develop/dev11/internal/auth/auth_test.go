@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAPIKeys(t *testing.T) {
+	keys := APIKeys{"alpha": 1, "beta": 2}
+
+	tests := []struct {
+		name   string
+		key    string
+		userID int
+		err    error
+	}{
+		{"known key", "beta", 2, nil},
+		{"unknown key", "gamma", 0, ErrInvalidCredentials},
+		{"no key", "", 0, ErrNoCredentials},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if test.key != "" {
+			r.Header.Set(APIKeyHeader, test.key)
+		}
+		principal, err := keys.Authenticate(r)
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: error = %v, want %v", test.name, err, test.err)
+		}
+		if err == nil && principal.UserID != test.userID {
+			t.Errorf("%s: user = %d, want %d", test.name, principal.UserID, test.userID)
+		}
+	}
+}
+
+func TestTokens(t *testing.T) {
+	now := time.Date(2025, 1, 16, 10, 0, 0, 0, time.UTC)
+	tokens := NewTokens([]byte("0123456789abcdef0123456789abcdef"))
+	tokens.now = func() time.Time { return now }
+
+	valid, err := tokens.Issue(7, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged, _ := NewTokens([]byte("another secret of thirty-two bytes")).Issue(7, time.Hour)
+	parts := strings.Split(valid, ".")
+	// {"alg":"none"} with the original claims and no signature.
+	unsigned := "eyJhbGciOiJub25lIn0." + parts[1] + "."
+
+	tests := []struct {
+		name          string
+		authorization string
+		advance       time.Duration
+		userID        int
+		err           error
+	}{
+		{"valid", "Bearer " + valid, 0, 7, nil},
+		{"lower-case scheme", "bearer " + valid, 0, 7, nil},
+		{"expired", "Bearer " + valid, time.Hour, 0, ErrInvalidCredentials},
+		{"other secret", "Bearer " + forged, 0, 0, ErrInvalidCredentials},
+		{"alg none", "Bearer " + unsigned, 0, 0, ErrInvalidCredentials},
+		{"tampered", "Bearer " + parts[0] + ".e30." + parts[2], 0, 0, ErrInvalidCredentials},
+		{"basic auth", "Basic dXNlcjpwYXNz", 0, 0, ErrNoCredentials},
+		{"no header", "", 0, 0, ErrNoCredentials},
+	}
+
+	for _, test := range tests {
+		tokens.now = func() time.Time { return now.Add(test.advance) }
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if test.authorization != "" {
+			r.Header.Set("Authorization", test.authorization)
+		}
+		principal, err := tokens.Authenticate(r)
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: error = %v, want %v", test.name, err, test.err)
+		}
+		if err == nil && principal.UserID != test.userID {
+			t.Errorf("%s: user = %d, want %d", test.name, principal.UserID, test.userID)
+		}
+	}
+}
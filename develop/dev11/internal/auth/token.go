@@ -0,0 +1,141 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// tokenHeader is the JOSE header of every token; only HS256 is accepted.
+type tokenHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ,omitempty"`
+}
+
+// tokenClaims are the JWT claims used by the API. The subject is the user ID; the expiry is required.
+type tokenClaims struct {
+	Subject   string `json:"sub"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	NotBefore int64  `json:"nbf,omitempty"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// Tokens issues and verifies JWT-compatible bearer tokens signed with HMAC-SHA256 (HS256).
+// Tokens are verified locally with the shared secret, without an external identity provider.
+type Tokens struct {
+	secret []byte
+	now    func() time.Time
+}
+
+// NewTokens creates a token authenticator with the given shared secret.
+func NewTokens(secret []byte) *Tokens {
+	return &Tokens{secret: secret, now: time.Now}
+}
+
+// Issue creates a token for the user that is valid for ttl.
+func (t *Tokens) Issue(userID int, ttl time.Duration) (string, error) {
+	if userID <= 0 {
+		return "", errors.New("user ID must be positive")
+	}
+	now := t.now()
+	header, err := json.Marshal(tokenHeader{Alg: "HS256", Typ: "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(tokenClaims{
+		Subject:   strconv.Itoa(userID),
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(ttl).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := encodeSegment(header) + "." + encodeSegment(claims)
+	return unsigned + "." + encodeSegment(t.sign(unsigned)), nil
+}
+
+// Authenticate verifies the bearer token of the request: its signature, algorithm and validity period.
+func (t *Tokens) Authenticate(r *http.Request) (*Principal, error) {
+	token := bearerToken(r)
+	if token == "" {
+		return nil, ErrNoCredentials
+	}
+
+	claims, err := t.verify(token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+	userID, err := strconv.Atoi(claims.Subject)
+	if err != nil || userID <= 0 {
+		return nil, fmt.Errorf("%w: subject %q is not a user ID", ErrInvalidCredentials, claims.Subject)
+	}
+	return &Principal{UserID: userID, Method: "token"}, nil
+}
+
+// verify checks the token and returns its claims.
+func (t *Tokens) verify(token string) (*tokenClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(signature, t.sign(parts[0]+"."+parts[1])) {
+		return nil, errors.New("bad signature")
+	}
+
+	var header tokenHeader
+	if err = decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	if header.Alg != "HS256" {
+		return nil, fmt.Errorf("unsupported algorithm %q", header.Alg)
+	}
+
+	var claims tokenClaims
+	if err = decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	now := t.now().Unix()
+	switch {
+	case claims.ExpiresAt == 0:
+		return nil, errors.New("token has no expiry")
+	case now >= claims.ExpiresAt:
+		return nil, errors.New("token expired")
+	case now < claims.NotBefore:
+		return nil, errors.New("token not valid yet")
+	}
+	return &claims, nil
+}
+
+// sign returns the HMAC-SHA256 of the signing input.
+func (t *Tokens) sign(input string) []byte {
+	mac := hmac.New(sha256.New, t.secret)
+	mac.Write([]byte(input))
+	return mac.Sum(nil)
+}
+
+// encodeSegment encodes a token segment in unpadded base64url.
+func encodeSegment(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeSegment decodes a base64url JSON segment of a token into v.
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return errors.New("malformed token")
+	}
+	if err = json.Unmarshal(data, v); err != nil {
+		return errors.New("malformed token")
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package calendar
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+const (
+	auditFile = "audit.log"
+
+	// defaultAuditLimit is used when no positive audit limit is given.
+	defaultAuditLimit = 100000
+)
+
+// AuditPurge is the type of the audit entries of events purged from the trash.
+// The other entries have the types of the changes reported to the listeners.
+const AuditPurge = "purge"
+
+// AuditEntry records a change of an event: its type, the actor who made it, when it was made,
+// and the event as stored before and after the change. Before is nil for a created event and After
+// for a purged one; a deleted event is recorded as moved to the trash, with its deletion time.
+type AuditEntry struct {
+	Type   string    `json:"type"`
+	UserID int       `json:"user_id"`
+	ID     int       `json:"id"`
+	Actor  string    `json:"actor,omitempty"`
+	At     time.Time `json:"at"`
+	Before *Event    `json:"before,omitempty"`
+	After  *Event    `json:"after,omitempty"`
+}
+
+// AuditFilter selects the audit entries of the user, or of every user if UserID is zero,
+// made in the half-open interval [From, To). A zero bound leaves that side of the interval open.
+type AuditFilter struct {
+	UserID int
+	From   time.Time
+	To     time.Time
+}
+
+// matches reports whether the filter selects the entry.
+func (f AuditFilter) matches(entry AuditEntry) bool {
+	return (f.UserID == 0 || entry.UserID == f.UserID) &&
+		(f.From.IsZero() || !entry.At.Before(f.From)) &&
+		(f.To.IsZero() || entry.At.Before(f.To))
+}
+
+// auditLog keeps the audit entries in the order they were made. For the file backend the entries are
+// also appended to a file next to the journal. Only the most recent limit entries are kept: once the log
+// holds twice as many, the older ones are dropped from memory and the file is rewritten without them.
+type auditLog struct {
+	entries []AuditEntry
+	limit   int
+	path    string
+	file    *os.File // nil for the in-memory backend.
+}
+
+// open loads the audit entries from the audit file in dir, dropping those over the limit,
+// and keeps the file open for appending.
+func (a *auditLog) open(dir string) error {
+	path := filepath.Join(dir, auditFile)
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log %s: %w", path, err)
+	}
+
+	err = readLines(file, func(line []byte) error {
+		var entry AuditEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return err
+		}
+		a.entries = append(a.entries, entry)
+		return nil
+	})
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("failed to read audit log %s: %w", path, err)
+	}
+	a.path = path
+	a.file = file
+	return a.trim()
+}
+
+// close closes the audit file, if there is one.
+func (a *auditLog) close() error {
+	if a.file == nil {
+		return nil
+	}
+	err := a.file.Close()
+	a.file = nil
+	return err
+}
+
+// maxEntries returns how many entries are kept.
+func (a *auditLog) maxEntries() int {
+	if a.limit <= 0 {
+		return defaultAuditLimit
+	}
+	return a.limit
+}
+
+// trim drops the entries over the limit, if there are any, and rewrites the audit file without them.
+// The file is replaced atomically, so a crash leaves either the old or the new one.
+func (a *auditLog) trim() error {
+	limit := a.maxEntries()
+	if len(a.entries) <= limit {
+		return nil
+	}
+	a.entries = slices.Clone(a.entries[len(a.entries)-limit:])
+	if a.file == nil {
+		return nil
+	}
+
+	var data []byte
+	for _, entry := range a.entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return fmt.Errorf("failed to encode audit entry: %w", err)
+		}
+		data = append(append(data, line...), '\n')
+	}
+	tmp := a.path + ".tmp"
+	if err := writeFileSync(tmp, data); err != nil {
+		return fmt.Errorf("failed to write audit log %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, a.path); err != nil {
+		return fmt.Errorf("failed to replace audit log %s: %w", a.path, err)
+	}
+
+	file, err := os.OpenFile(a.path, os.O_RDWR, 0o644)
+	if err == nil {
+		_, err = file.Seek(0, io.SeekEnd)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to reopen audit log %s: %w", a.path, err)
+	}
+	_ = a.file.Close()
+	a.file = file
+	return nil
+}
+
+// LimitAudit sets how many of the most recent audit entries are kept, trimming the log right away
+// if it is longer. A limit that is not positive restores the default.
+func (c *Calendar) LimitAudit(limit int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.audit.limit = limit
+	return c.audit.trim()
+}
+
+// record adds the entry to the audit log and durably appends it to the audit file. The change itself is already
+// committed, so an entry that cannot be written is only logged. The caller must hold c.mu.
+func (c *Calendar) record(entry AuditEntry) {
+	c.audit.entries = append(c.audit.entries, entry)
+	if c.audit.file != nil {
+		data, err := json.Marshal(entry)
+		if err == nil {
+			err = appendLine(c.audit.file, data)
+		}
+		if err != nil {
+			log.Println("Error writing audit log:", err)
+		}
+	}
+
+	if len(c.audit.entries) >= 2*c.audit.maxEntries() {
+		if err := c.audit.trim(); err != nil {
+			log.Println("Error trimming audit log:", err)
+		}
+	}
+}
+
+// History returns the audit entries of the user's event with the given ID, oldest first,
+// including those made while the event was in the trash and after it was purged.
+func (c *Calendar) History(userID, ID int) []AuditEntry {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var result []AuditEntry
+	for _, entry := range c.audit.entries {
+		if entry.UserID == userID && entry.ID == ID {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+// AuditLog returns the audit entries selected by the filter, oldest first.
+func (c *Calendar) AuditLog(filter AuditFilter) []AuditEntry {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var result []AuditEntry
+	for _, entry := range c.audit.entries {
+		if filter.matches(entry) {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
@@ -1,106 +1,448 @@
 package calendar
 
 import (
+	"context"
 	"errors"
+	"log"
+	"maps"
+	"slices"
+	"sort"
 	"sync"
 	"time"
 )
 
+// Calendar is the event storage. By default it keeps events only in memory;
+// a calendar created with OpenCalendar additionally writes every change to a journal on disk.
+// Every change is recorded in the audit log as made by the calendar's actor; As returns a view
+// of the same storage acting for another actor.
 type Calendar struct {
-	events sync.Map
+	*store
+	actor string
 }
 
-// Result is a structure for sending multiple events.
+// store is the state shared by a calendar and its views.
+type store struct {
+	mu      sync.RWMutex
+	events  map[eventKey]Event
+	trash   map[eventKey]Event // Deleted events kept until they are purged.
+	nextID  map[int]int        // Next free event ID per user.
+	journal *journal           // nil for the in-memory backend.
+	audit   auditLog
+	closed  bool
+
+	listeners []func(Change)
+}
+
+var (
+	// ErrNoSuchEvent is returned when the requested event does not exist or belongs to another user.
+	ErrNoSuchEvent = errors.New("no such event")
+	// ErrEventExists is returned when an event is created with an ID the user already has.
+	ErrEventExists = errors.New("event with this id already exists")
+	// ErrNotRecurring is returned when an occurrence of a one-off event is requested.
+	ErrNotRecurring = errors.New("event is not recurring")
+	// ErrNoSuchOccurrence is returned when a recurring event has no occurrence at the requested time.
+	ErrNoSuchOccurrence = errors.New("event has no such occurrence")
+	// ErrVersionMismatch is returned when an event was changed since the version the client based its update on.
+	ErrVersionMismatch = errors.New("event was modified concurrently")
+	// ErrInvalidEvent is returned when an event would not pass Event.Validate.
+	ErrInvalidEvent = errors.New("invalid event")
+	// ErrOverlap is returned when an event would overlap another event of the same user.
+	ErrOverlap = errors.New("event overlaps another event")
+	// ErrClosed is returned when a closed calendar is changed.
+	ErrClosed = errors.New("calendar is closed")
+)
+
+// Result is a structure for sending multiple events. NextPageToken is set if the events are
+// a page of a longer listing; passing it as 'page_token' fetches the next page.
 type Result struct {
-	Result []Event `json:"result"`
+	Result        []Event `json:"result"`
+	NextPageToken string  `json:"next_page_token,omitempty"`
 }
 
 // NewCalendar calendar constructor.
 func NewCalendar() *Calendar {
-	return &Calendar{}
+	return &Calendar{store: &store{
+		events: make(map[eventKey]Event),
+		trash:  make(map[eventKey]Event),
+		nextID: make(map[int]int),
+	}}
+}
+
+// OpenCalendar opens a file-backed calendar stored in dir, restoring events from the last snapshot
+// and the journal written after it, and the audit log. A snapshot is taken every snapshotEvery journal records.
+func OpenCalendar(dir string, snapshotEvery int) (*Calendar, error) {
+	c := NewCalendar()
+	j, err := openJournal(dir, snapshotEvery, c.apply, c.reserveID)
+	if err != nil {
+		return nil, err
+	}
+	if err = c.audit.open(dir); err != nil {
+		_ = j.file.Close()
+		return nil, err
+	}
+	c.journal = j
+	return c, nil
+}
+
+// As returns a view of the calendar whose changes are recorded in the audit log as made by actor.
+// The view shares the events, the journal and the listeners with the calendar.
+func (c *Calendar) As(actor string) *Calendar {
+	return &Calendar{store: c.store, actor: actor}
+}
+
+// Close takes a final snapshot and releases the journal and the audit log. Afterwards the events can still be read,
+// but every change fails with ErrClosed.
+func (c *Calendar) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closed = true
+	if c.journal == nil {
+		return nil
+	}
+	err := c.journal.close(c.snapshot())
+	if auditErr := c.audit.close(); err == nil {
+		err = auditErr
+	}
+	c.journal = nil
+	return err
+}
+
+// CheckHealth reports whether the calendar can persist changes: for the file backend, whether the journal
+// is still open and its directory is writable. The in-memory backend is always healthy.
+func (c *Calendar) CheckHealth(ctx context.Context) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if c.journal == nil {
+		return nil
+	}
+	return c.journal.check()
 }
 
-// CreateEvent adds an event to the calendar.
-func (c *Calendar) CreateEvent(event *Event) {
-	c.events.Store(event.ID, *event)
+// CreateEvent adds an event to the calendar. If the event has no ID, the next free ID
+// of its user is allocated and stored in event.ID; an ID that is already taken, even by an event
+// in the trash, is rejected.
+// The event keeps the time zone of its date and is confirmed unless it has another status.
+func (c *Calendar) CreateEvent(event *Event) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	tx := c.stage()
+	if err := tx.create(event); err != nil {
+		return err
+	}
+	return c.commitStaged(tx)
 }
 
-// UpdateEvent updates an existing event.
-func (c *Calendar) UpdateEvent(ID int, Title string, Date time.Time) error {
-	value, ok := c.events.Load(ID)
+// GetEvent returns the user's event with the given ID as stored, without expanding its recurrence.
+func (c *Calendar) GetEvent(userID, ID int) (*Event, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	event, ok := c.events[eventKey{UserID: userID, ID: ID}]
 	if !ok {
-		return errors.New("no such event")
+		return nil, ErrNoSuchEvent
 	}
+	return &event, nil
+}
+
+// UpdateEvent applies the patch to an existing event of the user and returns the updated event.
+// If version is not zero, the update is only made if the event is still at that version,
+// so that concurrent updates cannot silently overwrite each other. The updated event must still be valid.
+// Once the event is moved or its reminders are changed, only the reminders falling due afterwards are delivered.
+func (c *Calendar) UpdateEvent(userID, ID int, patch Patch, version int) (*Event, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	event := value.(Event) // Type casting.
-	if !Date.IsZero() {
-		event.Date = Date
+	tx := c.stage()
+	updated, err := tx.update(userID, ID, patch, version)
+	if err != nil {
+		return nil, err
 	}
-	if Title != "" {
-		event.Title = Title
+	if err = c.commitStaged(tx); err != nil {
+		return nil, err
 	}
-	c.events.Store(ID, event)
-	return nil
+	return &updated, nil
 }
 
-// DeleteEvent removes an event from the calendar.
-func (c *Calendar) DeleteEvent(ID int) (*Event, error) {
-	value, ok := c.events.LoadAndDelete(ID)
+// SetException cancels or moves a single occurrence of the user's recurring event, replacing any earlier
+// exception for the same occurrence. An exception that neither cancels nor moves restores the occurrence.
+func (c *Calendar) SetException(userID, ID int, exception Exception) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	event, ok := c.events[eventKey{UserID: userID, ID: ID}]
 	if !ok {
-		return nil, errors.New("no such event")
+		return ErrNoSuchEvent
+	}
+	if event.Recurrence == nil {
+		return ErrNotRecurring
+	}
+	if !event.hasOccurrence(exception.Occurrence) {
+		return ErrNoSuchOccurrence
+	}
+
+	exceptions := make([]Exception, 0, len(event.Exceptions)+1)
+	for _, e := range event.Exceptions {
+		if !e.Occurrence.Equal(exception.Occurrence) {
+			exceptions = append(exceptions, e)
+		}
+	}
+	if exception.Cancelled || exception.Date != nil {
+		exceptions = append(exceptions, exception)
 	}
+	before := event
+	event.Exceptions = exceptions
+	event.Version++
 
-	event := value.(Event)
+	if err := c.commit(record{Op: opPut, Event: event}); err != nil {
+		return err
+	}
+	c.notify(ChangeUpdate, &before, c.events[event.key()])
+	return nil
+}
+
+// DeleteEvent moves an event of the user to the trash and returns it as trashed, with its deletion time.
+// A trashed event is not seen by any query until it is restored with RestoreEvent or purged with PurgeTrash.
+func (c *Calendar) DeleteEvent(userID, ID int) (*Event, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	tx := c.stage()
+	event, err := tx.delete(userID, ID)
+	if err != nil {
+		return nil, err
+	}
+	if err = c.commitStaged(tx); err != nil {
+		return nil, err
+	}
 	return &event, nil
 }
 
-// DailyEvents returns events for the current day.
-func (c *Calendar) DailyEvents() []Event {
-	var result []Event
-	tYear, tMonth, tDay := time.Now().Date()
+// DailyEvents returns the user's events for the day containing date, in the time zone of date.
+// The same applies to WeeklyEvents and MonthlyEvents.
+func (c *Calendar) DailyEvents(userID int, date time.Time) []Event {
+	from := startOfDay(date)
+	return c.EventsInRange(userID, from, from.AddDate(0, 0, 1))
+}
 
-	c.events.Range(func(_, value interface{}) bool {
-		event := value.(Event)
-		year, month, day := event.Date.Date()
-		if tYear == year && tMonth == month && tDay == day {
-			result = append(result, event)
+// WeeklyEvents returns the user's events for the ISO week (Monday to Sunday) containing date.
+func (c *Calendar) WeeklyEvents(userID int, date time.Time) []Event {
+	from := startOfDay(date)
+	from = from.AddDate(0, 0, -(int(from.Weekday())+6)%7)
+	return c.EventsInRange(userID, from, from.AddDate(0, 0, 7))
+}
+
+// MonthlyEvents returns the user's events for the month containing date.
+func (c *Calendar) MonthlyEvents(userID int, date time.Time) []Event {
+	year, month, _ := date.Date()
+	from := time.Date(year, month, 1, 0, 0, 0, 0, date.Location())
+	return c.EventsInRange(userID, from, from.AddDate(0, 1, 0))
+}
+
+// EventsInRange returns the user's events that take place in the half-open interval [from, to),
+// sorted chronologically. Recurring events are expanded into their occurrences within the interval.
+func (c *Calendar) EventsInRange(userID int, from, to time.Time) []Event {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var result []Event
+	for _, event := range c.events {
+		if event.UserID == userID {
+			result = append(result, event.occurrencesIn(from, to)...)
 		}
-		return true
-	})
+	}
 
+	sortEvents(result)
 	return result
 }
 
-// WeeklyEvents returns events for the current week.
-func (c *Calendar) WeeklyEvents() []Event {
-	var result []Event
-	tYear, tWeek := time.Now().ISOWeek()
+// EventsOverlapping returns the user's events that take place, at least partly, in the half-open interval [from, to),
+// sorted chronologically: those that start before to and end after from. Events without an end are included
+// if they start in the interval, as by EventsInRange.
+func (c *Calendar) EventsOverlapping(userID int, from, to time.Time) []Event {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 
-	c.events.Range(func(_, value interface{}) bool {
-		event := value.(Event)
-		year, week := event.Date.ISOWeek()
-		if tYear == year && tWeek == week {
-			result = append(result, event)
+	var result []Event
+	for _, event := range c.events {
+		if event.UserID == userID {
+			result = append(result, event.occurrencesOverlapping(from, to)...)
 		}
-		return true
-	})
+	}
 
+	sortEvents(result)
 	return result
 }
 
-// MonthlyEvents returns events for the current month.
-func (c *Calendar) MonthlyEvents() []Event {
+// Overlapping returns the occurrences of the user's other events that overlap an occurrence of the given event,
+// sorted chronologically. The event does not have to be stored; if it is, it does not overlap itself.
+// An event without an end takes place at an instant, which overlaps the events going on at that instant
+// and the events starting at it. A recurring event is checked for a year ahead of its first occurrence.
+// Cancelled events overlap nothing.
+func (c *Calendar) Overlapping(event Event) []Event {
+	if event.Status == StatusCancelled {
+		return nil
+	}
+
+	horizon := event.Date.AddDate(1, 0, 0)
+	if event.Recurrence == nil {
+		horizon = event.Date.Add(time.Nanosecond)
+	}
+	occurrences := event.occurrencesIn(event.Date, horizon)
+	if len(occurrences) == 0 {
+		return nil
+	}
+	sortEvents(occurrences)
+	from, to := occurrences[0].Date, occurrences[0].Date
+	for _, occurrence := range occurrences {
+		to = maxTime(to, occurrence.busyUntil())
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
 	var result []Event
-	tYear, tMonth, _ := time.Now().Date()
+	for _, other := range c.events {
+		if other.UserID != event.UserID || other.ID == event.ID || other.Status == StatusCancelled {
+			continue
+		}
+		for _, instance := range other.occurrencesOverlapping(from, to) {
+			overlaps := func(occurrence Event) bool {
+				return occurrence.Date.Before(instance.busyUntil()) && instance.Date.Before(occurrence.busyUntil())
+			}
+			if slices.ContainsFunc(occurrences, overlaps) {
+				result = append(result, instance)
+			}
+		}
+	}
 
-	c.events.Range(func(_, value interface{}) bool {
-		event := value.(Event)
-		year, month, _ := event.Date.Date()
-		if tYear == year && tMonth == month {
-			result = append(result, event)
+	sortEvents(result)
+	return result
+}
+
+// busyUntil returns the end of the occurrence or, for an instant, the instant just after it,
+// so that occurrences can be compared as half-open intervals.
+func (e Event) busyUntil() time.Time {
+	if e.End != nil {
+		return *e.End
+	}
+	return e.Date.Add(time.Nanosecond)
+}
+
+// sortEvents sorts events by date and then by ID.
+func sortEvents(events []Event) {
+	sort.Slice(events, func(i, j int) bool {
+		if !events[i].Date.Equal(events[j].Date) {
+			return events[i].Date.Before(events[j].Date)
 		}
-		return true
+		return events[i].ID < events[j].ID
 	})
+}
 
+// AllEvents returns every event of the user as stored, without expanding recurring events,
+// sorted by the date of the (first) occurrence.
+func (c *Calendar) AllEvents(userID int) []Event {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var result []Event
+	for _, event := range c.events {
+		if event.UserID == userID {
+			result = append(result, event)
+		}
+	}
+	sortEvents(result)
 	return result
 }
+
+// EventCount returns the number of events stored for all users; a recurring event counts once.
+func (c *Calendar) EventCount() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return len(c.events)
+}
+
+// startOfDay returns midnight of the day containing t, in t's location.
+func startOfDay(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
+
+// commit writes the records to the journal, if there is one, and then applies them in memory,
+// so a change that could not be persisted is never visible. The records are written at once,
+// so they persist together or not at all. The caller must hold c.mu.
+func (c *Calendar) commit(records ...record) error {
+	if c.closed {
+		return ErrClosed
+	}
+	if c.journal != nil {
+		if err := c.journal.append(records...); err != nil {
+			return err
+		}
+	}
+	for _, rec := range records {
+		c.apply(rec)
+	}
+
+	if c.journal != nil && c.journal.snapshotDue() {
+		if err := c.journal.compact(c.snapshot()); err != nil {
+			// The record itself is already durable, so the change stands.
+			log.Println("Error taking snapshot:", err)
+		}
+	}
+	return nil
+}
+
+// allocateID returns the lowest ID above every ID the user has had so far. The caller must hold c.mu.
+func (c *Calendar) allocateID(userID int) int {
+	if next, ok := c.nextID[userID]; ok {
+		return next
+	}
+	return 1
+}
+
+// apply changes the in-memory state according to the record. A put record of an event
+// with a deletion time moves the event to the trash.
+func (c *Calendar) apply(rec record) {
+	key := rec.Event.key()
+	switch rec.Op {
+	case opPut:
+		if rec.Event.DeletedAt != nil {
+			delete(c.events, key)
+			c.trash[key] = rec.Event.localize()
+		} else {
+			delete(c.trash, key)
+			c.events[key] = rec.Event.localize()
+		}
+		c.reserveID(rec.Event.UserID, rec.Event.ID+1)
+	case opDelete:
+		delete(c.events, key)
+		delete(c.trash, key)
+	}
+}
+
+// reserveID makes sure that IDs below next are never allocated to the user.
+func (c *Calendar) reserveID(userID, next int) {
+	if next > c.allocateID(userID) {
+		c.nextID[userID] = next
+	}
+}
+
+// snapshot returns a copy of all stored events, including those in the trash, and of the next free IDs.
+// The caller must hold c.mu.
+func (c *Calendar) snapshot() snapshot {
+	events := make([]Event, 0, len(c.events)+len(c.trash))
+	for _, event := range c.events {
+		events = append(events, event)
+	}
+	for _, event := range c.trash {
+		events = append(events, event)
+	}
+	return snapshot{Events: events, NextID: maps.Clone(c.nextID)}
+}
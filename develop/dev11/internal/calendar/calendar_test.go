@@ -0,0 +1,879 @@
+package calendar
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOpenCalendarRestoresEvents(t *testing.T) {
+	dir := t.TempDir()
+	date := time.Date(2025, 1, 16, 15, 30, 0, 0, time.UTC)
+
+	c, err := OpenCalendar(dir, 2)
+	if err != nil {
+		t.Fatalf("OpenCalendar failed: %v", err)
+	}
+	c.CreateEvent(&Event{ID: 1, UserID: 1, Title: "first", Date: date})
+	c.CreateEvent(&Event{ID: 2, UserID: 1, Title: "second", Date: date}) // Triggers a snapshot.
+	c.CreateEvent(&Event{ID: 3, UserID: 1, Title: "third", Date: date})
+	renamed := "renamed"
+	if _, err = c.UpdateEvent(1, 1, Patch{Title: &renamed}, 0); err != nil {
+		t.Fatalf("UpdateEvent failed: %v", err)
+	}
+	if _, err = c.DeleteEvent(1, 2); err != nil {
+		t.Fatalf("DeleteEvent failed: %v", err)
+	}
+
+	// Simulate a crash: reopen without closing, then append half of a record.
+	journalPath := filepath.Join(dir, journalFile)
+	f, err := os.OpenFile(journalPath, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString(`{"op":"put","event":{"id":4,"ti`)
+	_ = f.Close()
+
+	restored, err := OpenCalendar(dir, 2)
+	if err != nil {
+		t.Fatalf("OpenCalendar after crash failed: %v", err)
+	}
+	defer func() { _ = restored.Close() }()
+
+	expected := map[int]string{1: "renamed", 3: "third"}
+	if len(restored.events) != len(expected) {
+		t.Fatalf("restored %d events, want %d: %v", len(restored.events), len(expected), restored.events)
+	}
+	for id, title := range expected {
+		if event := restored.events[eventKey{UserID: 1, ID: id}]; event.Title != title {
+			t.Errorf("event %d title = %q, want %q", id, event.Title, title)
+		}
+	}
+
+	// The torn record must be gone so new records are not glued to it.
+	restored.CreateEvent(&Event{ID: 5, UserID: 1, Title: "fifth", Date: date})
+	if _, err = OpenCalendar(dir, 100); err != nil {
+		t.Errorf("journal is unreadable after recovery: %v", err)
+	}
+}
+
+func TestDeletedIDsAreNotReused(t *testing.T) {
+	dir := t.TempDir()
+	date := time.Date(2025, 1, 16, 10, 0, 0, 0, time.UTC)
+
+	c, err := OpenCalendar(dir, 100)
+	if err != nil {
+		t.Fatalf("OpenCalendar failed: %v", err)
+	}
+	c.CreateEvent(&Event{UserID: 1, Title: "kept", Date: date})
+	c.CreateEvent(&Event{UserID: 1, Title: "purged", Date: date})
+	c.DeleteEvent(1, 2)
+	if _, err = c.PurgeTrash(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Close(); err != nil { // Compacts the journal into the snapshot.
+		t.Fatal(err)
+	}
+
+	c, err = OpenCalendar(dir, 100)
+	if err != nil {
+		t.Fatalf("OpenCalendar failed: %v", err)
+	}
+	defer func() { _ = c.Close() }()
+	event := &Event{UserID: 1, Title: "new", Date: date}
+	if err = c.CreateEvent(event); err != nil || event.ID != 3 {
+		t.Errorf("CreateEvent after restart allocated ID %d, %v; want 3", event.ID, err)
+	}
+}
+
+func TestOpenCalendarReadsEventArraySnapshot(t *testing.T) {
+	dir := t.TempDir()
+	data := `[{"id":4,"user_id":1,"title":"old","date":"2025-01-16T10:00:00Z","version":1}]`
+	if err := os.WriteFile(filepath.Join(dir, snapshotFile), []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := OpenCalendar(dir, 0)
+	if err != nil {
+		t.Fatalf("OpenCalendar failed: %v", err)
+	}
+	defer func() { _ = c.Close() }()
+	if event, err := c.GetEvent(1, 4); err != nil || event.Title != "old" {
+		t.Errorf("GetEvent = %v, %v; want the snapshotted event", event, err)
+	}
+}
+
+func TestJournalRollback(t *testing.T) {
+	dir := t.TempDir()
+	date := time.Date(2025, 1, 16, 10, 0, 0, 0, time.UTC)
+
+	c, err := OpenCalendar(dir, 100)
+	if err != nil {
+		t.Fatalf("OpenCalendar failed: %v", err)
+	}
+	c.CreateEvent(&Event{UserID: 1, Title: "first", Date: date})
+
+	// Simulate a write that failed half-way.
+	offset, _ := c.journal.file.Seek(0, io.SeekCurrent)
+	_, _ = c.journal.file.WriteString(`{"op":"put","event":{"id":2,"ti`)
+	failure := errors.New("disk full")
+	if err = rollback(c.journal.file, offset, failure); err != failure {
+		t.Fatalf("rollback = %v, want the error of the write", err)
+	}
+	c.CreateEvent(&Event{UserID: 1, Title: "second", Date: date})
+
+	// Reopen without closing, as after a crash: no record may be damaged.
+	restored, err := OpenCalendar(dir, 100)
+	if err != nil {
+		t.Fatalf("OpenCalendar after a failed write failed: %v", err)
+	}
+	if events := restored.AllEvents(1); len(events) != 2 {
+		t.Errorf("restored %d events, want 2", len(events))
+	}
+
+	if err = c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.CreateEvent(&Event{UserID: 1, Title: "late", Date: date}); !errors.Is(err, ErrClosed) {
+		t.Errorf("CreateEvent after Close: err = %v, want ErrClosed", err)
+	}
+	if _, err = c.GetEvent(1, 3); !errors.Is(err, ErrNoSuchEvent) {
+		t.Errorf("a change after Close is visible: err = %v", err)
+	}
+}
+
+func TestOpenCalendarRejectsCorruptMiddleRecord(t *testing.T) {
+	dir := t.TempDir()
+	data := "{\"op\":\"put\",\"event\":{\"id\":1}}\ngarbage\n{\"op\":\"put\",\"event\":{\"id\":2}}\n"
+	if err := os.WriteFile(filepath.Join(dir, journalFile), []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := OpenCalendar(dir, 0); err == nil {
+		t.Error("OpenCalendar succeeded on a journal with a corrupt record in the middle")
+	}
+}
+
+func TestPeriodQueries(t *testing.T) {
+	c := NewCalendar()
+	at := func(day, hour int) time.Time { return time.Date(2025, 1, day, hour, 0, 0, 0, time.UTC) }
+	c.CreateEvent(&Event{ID: 1, UserID: 1, Title: "later", Date: at(16, 18)})
+	c.CreateEvent(&Event{ID: 2, UserID: 1, Title: "earlier", Date: at(16, 9)})
+	c.CreateEvent(&Event{ID: 3, UserID: 1, Title: "sunday", Date: at(19, 23)})
+	c.CreateEvent(&Event{ID: 4, UserID: 1, Title: "next monday", Date: at(20, 0)})
+	c.CreateEvent(&Event{ID: 5, UserID: 1, Title: "next month", Date: time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)})
+
+	tests := []struct {
+		name     string
+		events   []Event
+		expected []int
+	}{
+		{"day", c.DailyEvents(1, at(16, 12)), []int{2, 1}},
+		{"week", c.WeeklyEvents(1, at(13, 0)), []int{2, 1, 3}},
+		{"month", c.MonthlyEvents(1, at(31, 0)), []int{2, 1, 3, 4}},
+		{"range", c.EventsInRange(1, at(19, 0), time.Date(2025, 2, 2, 0, 0, 0, 0, time.UTC)), []int{3, 4, 5}},
+		{"other user", c.MonthlyEvents(2, at(31, 0)), nil},
+	}
+
+	for _, test := range tests {
+		var ids []int
+		for _, event := range test.events {
+			ids = append(ids, event.ID)
+		}
+		if fmt.Sprint(ids) != fmt.Sprint(test.expected) {
+			t.Errorf("%s: got events %v, want %v", test.name, ids, test.expected)
+		}
+	}
+}
+
+func TestEventsAreScopedToUsers(t *testing.T) {
+	c := NewCalendar()
+	date := time.Date(2025, 1, 16, 15, 30, 0, 0, time.UTC)
+	c.CreateEvent(&Event{ID: 1, UserID: 1, Title: "mine", Date: date})
+	c.CreateEvent(&Event{ID: 1, UserID: 2, Title: "theirs", Date: date})
+
+	stolen := "stolen"
+	if _, err := c.UpdateEvent(3, 1, Patch{Title: &stolen}, 0); !errors.Is(err, ErrNoSuchEvent) {
+		t.Errorf("UpdateEvent by another user: got %v, want %v", err, ErrNoSuchEvent)
+	}
+	if _, err := c.DeleteEvent(3, 1); !errors.Is(err, ErrNoSuchEvent) {
+		t.Errorf("DeleteEvent by another user: got %v, want %v", err, ErrNoSuchEvent)
+	}
+
+	deleted, err := c.DeleteEvent(2, 1)
+	if err != nil || deleted.Title != "theirs" {
+		t.Fatalf("DeleteEvent(2, 1) = %v, %v; want the event of user 2", deleted, err)
+	}
+	if events := c.DailyEvents(1, date); len(events) != 1 || events[0].Title != "mine" {
+		t.Errorf("events of user 1 = %v, want only %q", events, "mine")
+	}
+}
+
+func TestCreateEventAllocatesIDs(t *testing.T) {
+	c := NewCalendar()
+	date := time.Date(2025, 1, 16, 15, 30, 0, 0, time.UTC)
+
+	explicit := &Event{ID: 5, UserID: 1, Title: "explicit", Date: date}
+	if err := c.CreateEvent(explicit); err != nil {
+		t.Fatalf("CreateEvent failed: %v", err)
+	}
+	allocated := &Event{UserID: 1, Title: "allocated", Date: date}
+	if err := c.CreateEvent(allocated); err != nil {
+		t.Fatalf("CreateEvent failed: %v", err)
+	}
+	if allocated.ID != 6 {
+		t.Errorf("allocated ID = %d, want 6", allocated.ID)
+	}
+	other := &Event{UserID: 2, Title: "other user", Date: date}
+	if err := c.CreateEvent(other); err != nil || other.ID != 1 {
+		t.Errorf("allocated ID for another user = %d, %v; want 1, nil", other.ID, err)
+	}
+
+	duplicate := &Event{ID: 5, UserID: 1, Title: "duplicate", Date: date}
+	if err := c.CreateEvent(duplicate); !errors.Is(err, ErrEventExists) {
+		t.Errorf("CreateEvent with a taken ID: got %v, want %v", err, ErrEventExists)
+	}
+	if events := c.DailyEvents(1, date); events[0].Title != "explicit" {
+		t.Errorf("event 5 was overwritten: %v", events[0])
+	}
+}
+
+func TestRecurringEvents(t *testing.T) {
+	at := func(month time.Month, day, hour int) time.Time {
+		return time.Date(2025, month, day, hour, 0, 0, 0, time.UTC)
+	}
+	until := at(time.March, 31, 23)
+
+	tests := []struct {
+		name       string
+		start      time.Time
+		recurrence Recurrence
+		from, to   time.Time
+		expected   []int // Days of month of the expected occurrences.
+	}{
+		{"daily with count", at(time.January, 30, 9), Recurrence{Freq: Daily, Count: 3},
+			at(time.January, 1, 0), at(time.March, 1, 0), []int{30, 31, 1}},
+		{"every other day", at(time.January, 1, 9), Recurrence{Freq: Daily, Interval: 2},
+			at(time.January, 20, 0), at(time.January, 26, 0), []int{21, 23, 25}},
+		{"weekly on weekdays", at(time.January, 15, 10), Recurrence{Freq: Weekly, ByDay: []time.Weekday{time.Monday, time.Wednesday, time.Friday}},
+			at(time.January, 13, 0), at(time.January, 25, 0), []int{15, 17, 20, 22, 24}},
+		{"monthly skips short months", at(time.January, 31, 12), Recurrence{Freq: Monthly, Until: &until},
+			at(time.January, 1, 0), at(time.December, 1, 0), []int{31, 31}},
+		{"long-running daily", time.Date(2020, 1, 1, 8, 0, 0, 0, time.UTC), Recurrence{Freq: Daily},
+			at(time.June, 1, 0), at(time.June, 3, 0), []int{1, 2}},
+	}
+
+	for _, test := range tests {
+		event := Event{ID: 1, UserID: 1, Date: test.start, Recurrence: &test.recurrence}
+		var days []int
+		for _, instance := range event.occurrencesIn(test.from, test.to) {
+			days = append(days, instance.Date.Day())
+		}
+		if fmt.Sprint(days) != fmt.Sprint(test.expected) {
+			t.Errorf("%s: got occurrences on days %v, want %v", test.name, days, test.expected)
+		}
+	}
+}
+
+func TestOccurrenceExceptions(t *testing.T) {
+	c := NewCalendar()
+	at := func(day, hour int) time.Time { return time.Date(2025, 1, day, hour, 0, 0, 0, time.UTC) }
+	standup := &Event{UserID: 1, Title: "standup", Date: at(20, 10), Recurrence: &Recurrence{Freq: Daily, Count: 5}}
+	if err := c.CreateEvent(standup); err != nil {
+		t.Fatal(err)
+	}
+	oneOff := &Event{UserID: 1, Title: "one-off", Date: at(20, 12)}
+	if err := c.CreateEvent(oneOff); err != nil {
+		t.Fatal(err)
+	}
+
+	moved := at(27, 9)
+	if err := c.SetException(1, standup.ID, Exception{Occurrence: at(21, 10), Cancelled: true}); err != nil {
+		t.Fatalf("cancelling an occurrence failed: %v", err)
+	}
+	if err := c.SetException(1, standup.ID, Exception{Occurrence: at(22, 10), Date: &moved}); err != nil {
+		t.Fatalf("moving an occurrence failed: %v", err)
+	}
+	if err := c.SetException(1, standup.ID, Exception{Occurrence: at(25, 10), Cancelled: true}); !errors.Is(err, ErrNoSuchOccurrence) {
+		t.Errorf("cancelling an occurrence past the count: got %v, want %v", err, ErrNoSuchOccurrence)
+	}
+	if err := c.SetException(1, oneOff.ID, Exception{Occurrence: at(20, 12), Cancelled: true}); !errors.Is(err, ErrNotRecurring) {
+		t.Errorf("cancelling an occurrence of a one-off event: got %v, want %v", err, ErrNotRecurring)
+	}
+
+	var dates []string
+	for _, event := range c.EventsInRange(1, at(1, 0), at(31, 0)) {
+		dates = append(dates, event.Date.Format("02 15:04"))
+	}
+	expected := []string{"20 10:00", "20 12:00", "23 10:00", "24 10:00", "27 09:00"}
+	if fmt.Sprint(dates) != fmt.Sprint(expected) {
+		t.Errorf("got events at %v, want %v", dates, expected)
+	}
+}
+
+func TestTimeZones(t *testing.T) {
+	moscow, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		t.Skip("time zone database is not available:", err)
+	}
+	berlin, _ := time.LoadLocation("Europe/Berlin")
+
+	c, err := OpenCalendar(t.TempDir(), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	late := &Event{UserID: 1, Title: "late", Date: time.Date(2025, 1, 17, 1, 30, 0, 0, moscow)}
+	weekly := &Event{UserID: 1, Title: "weekly", Date: time.Date(2025, 3, 24, 10, 0, 0, 0, berlin),
+		Recurrence: &Recurrence{Freq: Weekly, Count: 2}}
+	for _, event := range []*Event{late, weekly} {
+		if err = c.CreateEvent(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The same instant falls on different days depending on the requester's zone.
+	if events := c.DailyEvents(1, time.Date(2025, 1, 17, 0, 0, 0, 0, moscow)); len(events) != 1 {
+		t.Errorf("Moscow day of 17 January has %d events, want 1", len(events))
+	}
+	if events := c.DailyEvents(1, time.Date(2025, 1, 16, 0, 0, 0, 0, time.UTC)); len(events) != 1 {
+		t.Errorf("UTC day of 16 January has %d events, want 1", len(events))
+	}
+	if events := c.DailyEvents(1, time.Date(2025, 1, 17, 0, 0, 0, 0, time.UTC)); len(events) != 0 {
+		t.Errorf("UTC day of 17 January has %d events, want 0", len(events))
+	}
+
+	// A recurring event keeps its local time across the daylight saving change, also after a restart.
+	_ = c.journal.file.Close()
+	restored, err := OpenCalendar(c.journal.dir, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := time.Date(2025, 3, 1, 0, 0, 0, 0, berlin)
+	var clocks []string
+	for _, event := range restored.EventsInRange(1, from, from.AddDate(0, 1, 0)) {
+		clocks = append(clocks, event.Date.Format("02 15:04 MST"))
+	}
+	expected := []string{"24 10:00 CET", "31 10:00 CEST"}
+	if fmt.Sprint(clocks) != fmt.Sprint(expected) {
+		t.Errorf("weekly occurrences at %v, want %v", clocks, expected)
+	}
+}
+
+func TestUpdateEventPatch(t *testing.T) {
+	c := NewCalendar()
+	date := time.Date(2025, 1, 16, 10, 0, 0, 0, time.UTC)
+	event := &Event{UserID: 1, Title: "standup", Date: date, Recurrence: &Recurrence{Freq: Daily, Interval: 1}}
+	if err := c.CreateEvent(event); err != nil {
+		t.Fatal(err)
+	}
+
+	title := "retro"
+	updated, err := c.UpdateEvent(1, event.ID, Patch{Title: &title}, 1)
+	if err != nil {
+		t.Fatalf("UpdateEvent failed: %v", err)
+	}
+	if updated.Title != title || !updated.Date.Equal(date) || updated.Recurrence == nil || updated.Version != 2 {
+		t.Errorf("updated = %+v, want only the title changed and version 2", updated)
+	}
+
+	if _, err = c.UpdateEvent(1, event.ID, Patch{RemoveRecurrence: true}, 1); !errors.Is(err, ErrVersionMismatch) {
+		t.Errorf("stale version: got %v, want %v", err, ErrVersionMismatch)
+	}
+	if updated, err = c.UpdateEvent(1, event.ID, Patch{RemoveRecurrence: true}, 2); err != nil {
+		t.Fatalf("UpdateEvent failed: %v", err)
+	}
+	if updated.Recurrence != nil || updated.Title != title {
+		t.Errorf("updated = %+v, want the recurrence removed", updated)
+	}
+}
+
+func TestEventDetails(t *testing.T) {
+	c := NewCalendar()
+	date := time.Date(2025, 1, 16, 10, 0, 0, 0, time.UTC)
+	end := date.Add(time.Hour)
+	event := &Event{UserID: 1, Title: "planning", Date: date, End: &end, Attendees: []string{"ann@example.com"}}
+	if err := c.CreateEvent(event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Status != StatusConfirmed {
+		t.Errorf("status = %q, want %q", event.Status, StatusConfirmed)
+	}
+
+	moved := date.Add(2 * time.Hour)
+	updated, err := c.UpdateEvent(1, event.ID, Patch{Date: &moved}, 0)
+	if err != nil {
+		t.Fatalf("UpdateEvent failed: %v", err)
+	}
+	if updated.End == nil || !updated.End.Equal(moved.Add(time.Hour)) {
+		t.Errorf("end = %v, want it moved with the start", updated.End)
+	}
+
+	early := moved.Add(-time.Minute)
+	invalid := []struct {
+		name  string
+		patch Patch
+	}{
+		{"end before start", Patch{End: &early}},
+		{"bad attendee", Patch{Attendees: &[]string{"Ann <ann@example.com>"}}},
+		{"duplicate attendee", Patch{Attendees: &[]string{"ann@example.com", "ANN@example.com"}}},
+		{"unknown status", Patch{Status: ptr(Status("maybe"))}},
+		{"long location", Patch{Location: ptr(strings.Repeat("x", MaxLocationLength+1))}},
+	}
+	for _, test := range invalid {
+		if _, err = c.UpdateEvent(1, event.ID, test.patch, 0); !errors.Is(err, ErrInvalidEvent) {
+			t.Errorf("%s: got %v, want %v", test.name, err, ErrInvalidEvent)
+		}
+	}
+	if err = c.CreateEvent(&Event{UserID: 1, Title: "x", Date: date, End: &date}); !errors.Is(err, ErrInvalidEvent) {
+		t.Errorf("empty event: got %v, want %v", err, ErrInvalidEvent)
+	}
+}
+
+func TestEventsOverlapping(t *testing.T) {
+	c := NewCalendar()
+	at := func(day, hour int) time.Time { return time.Date(2025, 1, day, hour, 0, 0, 0, time.UTC) }
+	end := func(t time.Time) *time.Time { return &t }
+
+	c.CreateEvent(&Event{ID: 1, UserID: 1, Title: "long", Date: at(15, 22), End: end(at(16, 2))})
+	c.CreateEvent(&Event{ID: 2, UserID: 1, Title: "instant", Date: at(16, 9)})
+	c.CreateEvent(&Event{ID: 3, UserID: 1, Title: "ends at start", Date: at(15, 20), End: end(at(16, 0))})
+	c.CreateEvent(&Event{ID: 4, UserID: 1, Title: "nightly", Date: at(10, 23), End: end(at(11, 1)),
+		Recurrence: &Recurrence{Freq: Daily}})
+
+	var ids []int
+	for _, event := range c.EventsOverlapping(1, at(16, 0), at(17, 0)) {
+		ids = append(ids, event.ID)
+	}
+	if want := []int{1, 4, 2, 4}; !slices.Equal(ids, want) {
+		t.Errorf("overlapping events = %v, want %v", ids, want)
+	}
+	if events := c.EventsInRange(1, at(16, 0), at(17, 0)); len(events) != 2 {
+		t.Errorf("events starting in range = %d, want 2", len(events))
+	}
+}
+
+func TestOverlappingAndFreeSlots(t *testing.T) {
+	c := NewCalendar()
+	at := func(day, hour, minute int) time.Time { return time.Date(2025, 1, day, hour, minute, 0, 0, time.UTC) }
+	end := func(t time.Time) *time.Time { return &t }
+
+	c.CreateEvent(&Event{ID: 1, UserID: 1, Title: "standup", Date: at(13, 10, 0), End: end(at(13, 10, 30)),
+		Recurrence: &Recurrence{Freq: Daily}})
+	c.CreateEvent(&Event{ID: 2, UserID: 1, Title: "deadline", Date: at(16, 17, 0)})
+	c.CreateEvent(&Event{ID: 3, UserID: 1, Title: "lunch", Date: at(16, 12, 0), End: end(at(16, 13, 0))})
+	c.CreateEvent(&Event{ID: 4, UserID: 1, Title: "cancelled", Date: at(16, 14, 0), End: end(at(16, 15, 0)), Status: StatusCancelled})
+	c.CreateEvent(&Event{ID: 5, UserID: 2, Title: "other user", Date: at(16, 15, 0), End: end(at(16, 16, 0))})
+
+	tests := []struct {
+		name  string
+		event Event
+		want  []int
+	}{
+		{"back to back", Event{UserID: 1, Date: at(16, 10, 30), End: end(at(16, 12, 0))}, nil},
+		{"across lunch", Event{UserID: 1, Date: at(16, 11, 0), End: end(at(16, 12, 30))}, []int{3}},
+		{"instant during standup", Event{UserID: 1, Date: at(20, 10, 15)}, []int{1}},
+		{"at the deadline", Event{UserID: 1, Date: at(16, 16, 0), End: end(at(16, 17, 30))}, []int{2}},
+		{"over a cancelled event", Event{UserID: 1, Date: at(16, 14, 0), End: end(at(16, 16, 0))}, nil},
+		{"weekly series", Event{UserID: 1, Date: at(14, 10, 20), End: end(at(14, 11, 0)),
+			Recurrence: &Recurrence{Freq: Weekly, Count: 2}}, []int{1, 1}},
+		{"itself", Event{ID: 3, UserID: 1, Date: at(16, 12, 0), End: end(at(16, 13, 0))}, nil},
+	}
+	for _, test := range tests {
+		var ids []int
+		for _, event := range c.Overlapping(test.event) {
+			ids = append(ids, event.ID)
+		}
+		if !slices.Equal(ids, test.want) {
+			t.Errorf("%s: overlapping = %v, want %v", test.name, ids, test.want)
+		}
+	}
+
+	from, to := at(16, 9, 0), at(16, 18, 0)
+	slots := FreeSlots(c.EventsOverlapping(1, from, to), from, to, time.Hour)
+	want := []Slot{{at(16, 9, 0), at(16, 10, 0)}, {at(16, 10, 30), at(16, 12, 0)}, {at(16, 13, 0), at(16, 18, 0)}}
+	if !slices.Equal(slots, want) {
+		t.Errorf("free slots = %v, want %v", slots, want)
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	at := func(day int) time.Time { return time.Date(2025, 1, day, 10, 0, 0, 0, time.UTC) }
+	events := []Event{
+		{ID: 1, Title: "Standup", Date: at(13)},
+		{ID: 2, Title: "retro", Date: at(14)},
+		{ID: 3, Title: "Planning", Date: at(14)},
+		{ID: 4, Title: "standup notes", Date: at(15)},
+		{ID: 1, Title: "Standup", Date: at(16)},
+	}
+
+	pages := func(options ListOptions) [][]int {
+		var result [][]int
+		for {
+			page := Paginate(events, options)
+			var ids []int
+			for _, event := range page.Result {
+				ids = append(ids, event.ID)
+			}
+			result = append(result, ids)
+			if page.NextPageToken == "" {
+				return result
+			}
+			cursor, err := ParseCursor(page.NextPageToken)
+			if err != nil {
+				t.Fatalf("ParseCursor failed: %v", err)
+			}
+			options.After = cursor
+		}
+	}
+
+	tests := []struct {
+		name    string
+		options ListOptions
+		want    [][]int
+	}{
+		{"by date", ListOptions{Limit: 2, Sort: SortByDate}, [][]int{{1, 2}, {3, 4}, {1}}},
+		{"by title", ListOptions{Limit: 3, Sort: SortByTitle}, [][]int{{3, 2, 1}, {1, 4}}},
+		{"query", ListOptions{Limit: 2, Sort: SortByDate, Query: "STANDUP"}, [][]int{{1, 4}, {1}}},
+		{"no limit", ListOptions{Sort: SortByDate}, [][]int{{1, 2, 3, 4, 1}}},
+		{"exact page", ListOptions{Limit: 5, Sort: SortByDate}, [][]int{{1, 2, 3, 4, 1}}},
+	}
+	for _, test := range tests {
+		if got := pages(test.options); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: pages = %v, want %v", test.name, got, test.want)
+		}
+	}
+
+	if _, err := ParseCursor("bm9wZQ"); err == nil {
+		t.Error("ParseCursor accepted a malformed token")
+	}
+}
+
+// ptr returns a pointer to a copy of v.
+func TestTransaction(t *testing.T) {
+	dir := t.TempDir()
+	date := time.Date(2025, 1, 16, 10, 0, 0, 0, time.UTC)
+
+	c, err := OpenCalendar(dir, 100)
+	if err != nil {
+		t.Fatalf("OpenCalendar failed: %v", err)
+	}
+	c.CreateEvent(&Event{UserID: 1, Title: "existing", Date: date})
+	var changes []string
+	c.OnChange(func(change Change) { changes = append(changes, change.Type) })
+
+	// A failing operation rolls back the ones before it.
+	_, err = c.Transaction([]Operation{
+		{Op: ChangeCreate, Event: &Event{UserID: 1, Title: "new", Date: date}},
+		{Op: ChangeDelete, UserID: 1, ID: 1},
+		{Op: ChangeUpdate, UserID: 1, ID: 1, Patch: Patch{Title: ptr("gone")}},
+	})
+	var opErr *OperationError
+	if !errors.As(err, &opErr) || opErr.Index != 2 || !errors.Is(err, ErrNoSuchEvent) {
+		t.Fatalf("Transaction error = %v, want operation 2 failing with ErrNoSuchEvent", err)
+	}
+	if len(c.events) != 1 || len(changes) != 0 {
+		t.Fatalf("failed transaction left %d events and reported %v", len(c.events), changes)
+	}
+
+	// Later operations see the earlier ones.
+	events, err := c.Transaction([]Operation{
+		{Op: ChangeCreate, Event: &Event{UserID: 1, Title: "new", Date: date}},
+		{Op: ChangeUpdate, UserID: 1, ID: 2, Patch: Patch{Title: ptr("renamed")}, Version: 1},
+		{Op: ChangeCreate, Event: &Event{UserID: 1, Title: "third", Date: date}},
+		{Op: ChangeDelete, UserID: 1, ID: 1},
+	})
+	if err != nil {
+		t.Fatalf("Transaction failed: %v", err)
+	}
+	var got []string
+	for _, event := range events {
+		got = append(got, fmt.Sprintf("%d %s v%d", event.ID, event.Title, event.Version))
+	}
+	if want := []string{"2 new v1", "2 renamed v2", "3 third v1", "1 existing v1"}; !slices.Equal(got, want) {
+		t.Errorf("Transaction results = %v, want %v", got, want)
+	}
+	if want := []string{ChangeCreate, ChangeUpdate, ChangeCreate, ChangeDelete}; !slices.Equal(changes, want) {
+		t.Errorf("reported changes = %v, want %v", changes, want)
+	}
+
+	// The transaction is journaled as a whole.
+	restored, err := OpenCalendar(dir, 100)
+	if err != nil {
+		t.Fatalf("OpenCalendar failed: %v", err)
+	}
+	defer func() { _ = restored.Close() }()
+	var titles []string
+	for _, event := range restored.AllEvents(1) {
+		titles = append(titles, event.Title)
+	}
+	if want := []string{"renamed", "third"}; !slices.Equal(titles, want) {
+		t.Errorf("restored events = %v, want %v", titles, want)
+	}
+	if err = restored.CreateEvent(&Event{UserID: 1, Title: "fourth", Date: date}); err != nil {
+		t.Fatal(err)
+	}
+	if event, err := restored.GetEvent(1, 4); err != nil || event.Title != "fourth" {
+		t.Errorf("next ID after restore: event 4 = %v, %v", event, err)
+	}
+}
+
+func TestTrash(t *testing.T) {
+	dir := t.TempDir()
+	date := time.Date(2025, 1, 16, 10, 0, 0, 0, time.UTC)
+
+	c, err := OpenCalendar(dir, 100)
+	if err != nil {
+		t.Fatalf("OpenCalendar failed: %v", err)
+	}
+	c.CreateEvent(&Event{UserID: 1, Title: "kept", Date: date})
+	c.CreateEvent(&Event{UserID: 1, Title: "deleted", Date: date.Add(time.Hour)})
+	c.CreateEvent(&Event{UserID: 1, Title: "purged", Date: date.Add(2 * time.Hour)})
+
+	deleted, err := c.DeleteEvent(1, 2)
+	if err != nil || deleted.DeletedAt == nil {
+		t.Fatalf("DeleteEvent = %v, %v; want the event with its deletion time", deleted, err)
+	}
+	c.DeleteEvent(1, 3)
+
+	if _, err = c.GetEvent(1, 2); !errors.Is(err, ErrNoSuchEvent) {
+		t.Errorf("GetEvent of a trashed event: err = %v, want ErrNoSuchEvent", err)
+	}
+	if events := c.DailyEvents(1, date); len(events) != 1 || events[0].ID != 1 {
+		t.Errorf("DailyEvents = %v, want only the kept event", events)
+	}
+	if err = c.CreateEvent(&Event{ID: 2, UserID: 1, Title: "again", Date: date}); !errors.Is(err, ErrEventExists) {
+		t.Errorf("CreateEvent with a trashed ID: err = %v, want ErrEventExists", err)
+	}
+	if trash := c.Trash(1); len(trash) != 2 || len(c.Trash(2)) != 0 {
+		t.Errorf("Trash = %v, want the two deleted events of user 1", trash)
+	}
+
+	if purged, err := c.PurgeTrash(time.Now().Add(-time.Hour)); err != nil || purged != 0 {
+		t.Errorf("PurgeTrash of nothing expired = %d, %v", purged, err)
+	}
+	restored, err := c.RestoreEvent(1, 2)
+	if err != nil || restored.DeletedAt != nil || restored.Version != 2 {
+		t.Fatalf("RestoreEvent = %+v, %v; want version 2 without a deletion time", restored, err)
+	}
+	if _, err = c.RestoreEvent(1, 2); !errors.Is(err, ErrNoSuchEvent) {
+		t.Errorf("second RestoreEvent: err = %v, want ErrNoSuchEvent", err)
+	}
+
+	// The trash survives a restart, and purged events are gone for good.
+	if err = c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	c, err = OpenCalendar(dir, 100)
+	if err != nil {
+		t.Fatalf("OpenCalendar failed: %v", err)
+	}
+	defer func() { _ = c.Close() }()
+	if trash := c.Trash(1); len(trash) != 1 || trash[0].Title != "purged" {
+		t.Fatalf("restored trash = %v, want the purged event", trash)
+	}
+	if purged, err := c.PurgeTrash(time.Now()); err != nil || purged != 1 {
+		t.Errorf("PurgeTrash = %d, %v; want 1", purged, err)
+	}
+	if _, err = c.RestoreEvent(1, 3); !errors.Is(err, ErrNoSuchEvent) {
+		t.Errorf("RestoreEvent of a purged event: err = %v, want ErrNoSuchEvent", err)
+	}
+	if events := c.AllEvents(1); len(events) != 2 {
+		t.Errorf("AllEvents = %v, want the two live events", events)
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	dir := t.TempDir()
+	date := time.Date(2025, 1, 16, 10, 0, 0, 0, time.UTC)
+
+	c, err := OpenCalendar(dir, 100)
+	if err != nil {
+		t.Fatalf("OpenCalendar failed: %v", err)
+	}
+	alice, bob := c.As("alice"), c.As("bob")
+	alice.CreateEvent(&Event{UserID: 1, Title: "Meeting", Date: date})
+	start := time.Now()
+	bob.UpdateEvent(1, 1, Patch{Date: ptr(date.Add(time.Hour))}, 0)
+	bob.CreateEvent(&Event{UserID: 2, Title: "Other", Date: date})
+	alice.DeleteEvent(1, 1)
+	c.RestoreEvent(1, 1)
+
+	history := c.History(1, 1)
+	var got []string
+	for _, entry := range history {
+		got = append(got, entry.Type+" by "+entry.Actor)
+	}
+	if want := []string{"create by alice", "update by bob", "delete by alice", "restore by "}; !slices.Equal(got, want) {
+		t.Fatalf("History = %v, want %v", got, want)
+	}
+	if moved := history[1]; moved.Before == nil || !moved.Before.Date.Equal(date) || !moved.After.Date.Equal(date.Add(time.Hour)) {
+		t.Errorf("update entry = %+v, want the date before and after the move", moved)
+	}
+	if history[0].Before != nil || history[2].After.DeletedAt == nil {
+		t.Errorf("create entry has a before snapshot or delete entry has no deletion time: %+v", history)
+	}
+
+	if entries := c.AuditLog(AuditFilter{UserID: 2}); len(entries) != 1 || entries[0].Actor != "bob" {
+		t.Errorf("AuditLog of user 2 = %+v, want the single create", entries)
+	}
+	if entries := c.AuditLog(AuditFilter{From: start}); len(entries) != 4 {
+		t.Errorf("AuditLog from the update holds %d entries, want 4", len(entries))
+	}
+	if entries := c.AuditLog(AuditFilter{To: start}); len(entries) != 1 {
+		t.Errorf("AuditLog before the update holds %d entries, want 1", len(entries))
+	}
+
+	// The audit log survives a restart and records purges.
+	c.DeleteEvent(2, 1)
+	if err = c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	c, err = OpenCalendar(dir, 100)
+	if err != nil {
+		t.Fatalf("OpenCalendar failed: %v", err)
+	}
+	defer func() { _ = c.Close() }()
+	c.As("purger").PurgeTrash(time.Now())
+	history = c.History(2, 1)
+	if len(history) != 3 || history[2].Type != AuditPurge || history[2].Actor != "purger" || history[2].After != nil {
+		t.Errorf("History after a purge = %+v", history)
+	}
+	if entries := c.AuditLog(AuditFilter{}); len(entries) != 7 {
+		t.Errorf("restored AuditLog holds %d entries, want 7", len(entries))
+	}
+}
+
+func TestAuditLimit(t *testing.T) {
+	dir := t.TempDir()
+	date := time.Date(2025, 1, 16, 10, 0, 0, 0, time.UTC)
+
+	c, err := OpenCalendar(dir, 100)
+	if err != nil {
+		t.Fatalf("OpenCalendar failed: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		c.CreateEvent(&Event{UserID: 1, Title: "event", Date: date.Add(time.Duration(i) * time.Hour)})
+	}
+	if err = c.LimitAudit(2); err != nil {
+		t.Fatalf("LimitAudit failed: %v", err)
+	}
+	if entries := c.AuditLog(AuditFilter{}); len(entries) != 2 || entries[0].ID != 4 {
+		t.Fatalf("AuditLog after LimitAudit = %+v, want the last 2 entries", entries)
+	}
+
+	// The log grows to twice the limit before the older entries are dropped again.
+	c.DeleteEvent(1, 1)
+	c.DeleteEvent(1, 2)
+	if entries := c.AuditLog(AuditFilter{}); len(entries) != 2 || entries[0].ID != 1 {
+		t.Errorf("AuditLog at twice the limit = %+v, want the last 2 entries", entries)
+	}
+	c.DeleteEvent(1, 3)
+	if err = c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The file holds what was kept and what was appended afterwards.
+	c, err = OpenCalendar(dir, 100)
+	if err != nil {
+		t.Fatalf("OpenCalendar failed: %v", err)
+	}
+	defer func() { _ = c.Close() }()
+	var got []int
+	for _, entry := range c.AuditLog(AuditFilter{}) {
+		got = append(got, entry.ID)
+	}
+	if want := []int{1, 2, 3}; !slices.Equal(got, want) {
+		t.Errorf("restored AuditLog has the entries of events %v, want %v", got, want)
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestDueReminders(t *testing.T) {
+	dir := t.TempDir()
+	c, err := OpenCalendar(dir, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2025, 1, 16, 10, 0, 0, 0, time.UTC)
+	c.CreateEvent(&Event{UserID: 1, Title: "one-off", Date: start, Reminders: []int{15, 60}})
+	c.CreateEvent(&Event{UserID: 2, Title: "daily", Date: start, Reminders: []int{10},
+		Recurrence: &Recurrence{Freq: Daily, Interval: 1}})
+	c.CreateEvent(&Event{UserID: 3, Title: "instant", Date: start.Add(time.Hour), Reminders: []int{0}})
+	const grace = 30 * time.Second // The interval of the checks.
+
+	at := func(hour, minute int) time.Time { return time.Date(2025, 1, 16, hour, minute, 0, 0, time.UTC) }
+	steps := []struct {
+		name   string
+		now    time.Time
+		reopen bool
+		want   []string // Titles with the minutes before, in order of delivery.
+	}{
+		{"too early", at(8, 59), false, nil},
+		{"first reminder", at(9, 0), false, []string{"one-off 60"}},
+		{"nothing new", at(9, 30), false, nil},
+		{"two due at once", at(9, 50), false, []string{"one-off 15", "daily 10"}},
+		{"after restart", at(9, 55), true, nil},
+		{"at the start", at(11, 0).Add(-grace / 2), false, nil},
+		{"just after the start", at(11, 0).Add(grace / 2), false, []string{"instant 0"}},
+		{"missed while down", time.Date(2025, 1, 17, 10, 1, 0, 0, time.UTC), false, nil},
+		{"next occurrence", time.Date(2025, 1, 18, 9, 51, 0, 0, time.UTC), false, []string{"daily 10"}},
+	}
+
+	for _, step := range steps {
+		if step.reopen {
+			_ = c.Close()
+			if c, err = OpenCalendar(dir, 100); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var got []string
+		for _, due := range c.DueReminders(step.now, grace) {
+			got = append(got, fmt.Sprintf("%s %d", due.Event.Title, int(due.Before.Minutes())))
+			if err = c.MarkReminded(due.Event.UserID, due.Event.ID, due.FireAt); err != nil {
+				t.Fatalf("MarkReminded failed: %v", err)
+			}
+		}
+		if !slices.Equal(got, step.want) {
+			t.Errorf("%s: due = %v, want %v", step.name, got, step.want)
+		}
+	}
+
+	if event, _ := c.GetEvent(1, 1); event.Version != 1 {
+		t.Errorf("version = %d after reminders, want 1", event.Version)
+	}
+}
+
+func TestDueRemindersAfterUpdate(t *testing.T) {
+	c := NewCalendar()
+	now := time.Now()
+	c.CreateEvent(&Event{UserID: 1, Title: "meeting", Date: now.Add(30 * time.Minute), Reminders: []int{60}})
+	for _, due := range c.DueReminders(now, 0) {
+		c.MarkReminded(1, 1, due.FireAt)
+	}
+
+	// A delivered reminder is not delivered again once the event is moved or gets more reminders.
+	if _, err := c.UpdateEvent(1, 1, Patch{Date: ptr(now.Add(35 * time.Minute))}, 0); err != nil {
+		t.Fatalf("UpdateEvent failed: %v", err)
+	}
+	if due := c.DueReminders(time.Now(), 0); len(due) != 0 {
+		t.Errorf("due after the move = %+v, want none", due)
+	}
+	if _, err := c.UpdateEvent(1, 1, Patch{Reminders: &[]int{60, 10}}, 0); err != nil {
+		t.Fatalf("UpdateEvent failed: %v", err)
+	}
+	due := c.DueReminders(now.Add(26*time.Minute), 0)
+	if len(due) != 1 || due[0].Before != 10*time.Minute {
+		t.Errorf("due after adding a reminder = %+v, want only the new one", due)
+	}
+}
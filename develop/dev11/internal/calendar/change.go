@@ -0,0 +1,48 @@
+package calendar
+
+import "time"
+
+// Types of changes reported to the listeners registered with OnChange.
+const (
+	ChangeCreate  = "create"
+	ChangeUpdate  = "update"
+	ChangeDelete  = "delete"
+	ChangeRestore = "restore"
+)
+
+// Change describes a change made to an event: its type, the event as it is after the change
+// (or as moved to the trash by a deletion), and when the change was made.
+type Change struct {
+	Type  string    `json:"type"`
+	Event Event     `json:"event"`
+	At    time.Time `json:"at"`
+}
+
+// OnChange registers a listener that is called after every create, update, delete and restore is committed,
+// in the order of the changes. Listeners are called with the calendar locked, so they must return quickly
+// and must not call back into the calendar. Delivery bookkeeping, such as MarkReminded, and purging the trash
+// are not reported.
+func (c *Calendar) OnChange(listener func(Change)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.listeners = append(c.listeners, listener)
+}
+
+// notify records the change of the event from before, which is nil for a created event, in the audit log
+// and reports it to the listeners. The caller must hold c.mu.
+func (c *Calendar) notify(changeType string, before *Event, event Event) {
+	change := Change{Type: changeType, Event: event, At: time.Now()}
+	c.record(AuditEntry{
+		Type:   changeType,
+		UserID: event.UserID,
+		ID:     event.ID,
+		Actor:  c.actor,
+		At:     change.At,
+		Before: before,
+		After:  &event,
+	})
+	for _, listener := range c.listeners {
+		listener(change)
+	}
+}
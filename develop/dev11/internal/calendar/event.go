@@ -1,11 +1,262 @@
 package calendar
 
-import "time"
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
 
-// Event represents a scheduled event with an ID, title, and date.
-// The fields are serialized to and from JSON format, allowing easy data exchange in web applications.
+// Status is the state of an event, named as by the iCalendar STATUS property.
+type Status string
+
+// Statuses of an event.
+const (
+	StatusTentative Status = "tentative"
+	StatusConfirmed Status = "confirmed"
+	StatusCancelled Status = "cancelled"
+)
+
+// Limits of the details of an event. Lengths are counted in characters.
+const (
+	MaxTitleLength       = 200
+	MaxDescriptionLength = 4000
+	MaxLocationLength    = 200
+	MaxAttendees         = 100
+)
+
+// Event represents a scheduled event owned by a user. Event IDs are unique per user, so an event
+// is identified by the pair of UserID and ID. The fields are serialized to and from JSON.
 type Event struct {
-	ID    int       `json:"id"`
-	Title string    `json:"title"`
-	Date  time.Time `json:"date"`
+	ID          int    `json:"id"`
+	UserID      int    `json:"user_id"`
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Location    string `json:"location,omitempty"`
+	// Date is the start of the event, or of its first occurrence, kept in the zone named by TimeZone,
+	// so that a recurring event keeps its local time across daylight saving changes.
+	Date time.Time `json:"date"`
+	// End, if set, is the end of the event; every occurrence lasts for the same Duration.
+	// An event without an end takes place at an instant.
+	End        *time.Time  `json:"end,omitempty"`
+	TimeZone   string      `json:"time_zone,omitempty"`
+	Recurrence *Recurrence `json:"recurrence,omitempty"`
+	Exceptions []Exception `json:"exceptions,omitempty"` // Cancelled or moved occurrences.
+	// Occurrence is set only on the instances of a recurring event returned by queries
+	// and holds the original start of the instance.
+	Occurrence *time.Time `json:"occurrence,omitempty"`
+	// Version is incremented on every change of the event and serves as its ETag.
+	Version   int   `json:"version"`
+	Reminders []int `json:"reminders,omitempty"` // Minutes before the start of every occurrence.
+	// RemindedUntil is the time the last delivered reminder fell due, so that no reminder is delivered twice.
+	RemindedUntil *time.Time `json:"reminded_until,omitempty"`
+	Attendees     []string   `json:"attendees,omitempty"` // E-mail addresses.
+	// Status is confirmed for an event created without one; events stored before statuses
+	// were introduced have none and count as confirmed too.
+	Status Status `json:"status,omitempty"`
+	// DeletedAt is set only on events in the trash and holds the time they were deleted.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// Duration returns how long every occurrence of the event lasts, or 0 if the event has no end.
+func (e Event) Duration() time.Duration {
+	if e.End == nil {
+		return 0
+	}
+	return e.End.Sub(e.Date)
+}
+
+// Validate checks the details of the event: the length of its texts, that it ends after it starts,
+// its attendees and its status. The recurrence and the reminders are checked by Recurrence.Validate
+// and ValidateReminders.
+func (e Event) Validate() error {
+	switch {
+	case utf8.RuneCountInString(e.Title) > MaxTitleLength:
+		return fmt.Errorf("title must be at most %d characters long", MaxTitleLength)
+	case utf8.RuneCountInString(e.Description) > MaxDescriptionLength:
+		return fmt.Errorf("description must be at most %d characters long", MaxDescriptionLength)
+	case utf8.RuneCountInString(e.Location) > MaxLocationLength:
+		return fmt.Errorf("location must be at most %d characters long", MaxLocationLength)
+	case e.End != nil && !e.End.After(e.Date):
+		return errors.New("end must be after the start of the event")
+	case len(e.Attendees) > MaxAttendees:
+		return fmt.Errorf("an event can have at most %d attendees", MaxAttendees)
+	}
+
+	for i, attendee := range e.Attendees {
+		if address, err := mail.ParseAddress(attendee); err != nil || address.Address != attendee {
+			return fmt.Errorf("attendee %q is not an e-mail address", attendee)
+		}
+		if slices.ContainsFunc(e.Attendees[:i], func(other string) bool { return strings.EqualFold(other, attendee) }) {
+			return fmt.Errorf("duplicate attendee %q", attendee)
+		}
+	}
+
+	switch e.Status {
+	case "", StatusTentative, StatusConfirmed, StatusCancelled:
+		return nil
+	default:
+		return fmt.Errorf("status %q is not one of tentative, confirmed, cancelled", e.Status)
+	}
+}
+
+// Patch describes a partial update of an event: only the fields that are set are changed.
+// A new recurrence rule replaces the old one, and RemoveRecurrence turns the event into a one-off event.
+// Reminders, if set, replace all reminders of the event; an empty list removes them. The same applies to Attendees.
+// Moving an event that has an end moves the end too, unless a new End is given; RemoveEnd turns it into an instant.
+// An empty Status confirms the event.
+type Patch struct {
+	Title       *string
+	Description *string
+	Location    *string
+	// Date moves the event and, unless KeepTimeZone is set, sets its time zone to the location of Date.
+	Date *time.Time
+	End  *time.Time
+	// KeepTimeZone keeps the time zone of the event when it is moved: Date and End are converted to it.
+	// With LocalTimes they are instead read as the clock times they show, in the event's zone,
+	// for dates that were given without a zone or an offset.
+	KeepTimeZone     bool
+	LocalTimes       bool
+	RemoveEnd        bool
+	Recurrence       *Recurrence
+	RemoveRecurrence bool
+	Reminders        *[]int
+	Attendees        *[]string
+	Status           *Status
+}
+
+// Apply returns the event with the patch applied. Changing the schedule drops the exceptions,
+// as they refer to the occurrences of the old schedule. A new date also sets the time zone of the event,
+// unless the patch keeps it.
+func (p Patch) Apply(e Event) Event {
+	if p.Title != nil {
+		e.Title = *p.Title
+	}
+	if p.Description != nil {
+		e.Description = *p.Description
+	}
+	if p.Location != nil {
+		e.Location = *p.Location
+	}
+	if p.Date != nil {
+		date := *p.Date
+		if p.KeepTimeZone {
+			date = p.inZone(date, e.Date.Location())
+		}
+		if !date.Equal(e.Date) {
+			e.Exceptions = nil
+		}
+		if e.End != nil {
+			end := date.Add(e.Duration())
+			e.End = &end
+		}
+		e.Date = date
+		e.TimeZone = date.Location().String()
+	}
+	if p.End != nil {
+		end := p.inZone(*p.End, e.Date.Location())
+		e.End = &end
+	}
+	if p.RemoveEnd {
+		e.End = nil
+	}
+	if p.Recurrence != nil {
+		e.Recurrence = p.Recurrence
+		e.Exceptions = nil
+	}
+	if p.RemoveRecurrence {
+		e.Recurrence = nil
+		e.Exceptions = nil
+	}
+	if p.Reminders != nil {
+		e.Reminders = nil
+		if len(*p.Reminders) > 0 {
+			e.Reminders = slices.Clone(*p.Reminders)
+		}
+	}
+	if p.Attendees != nil {
+		e.Attendees = nil
+		if len(*p.Attendees) > 0 {
+			e.Attendees = slices.Clone(*p.Attendees)
+		}
+	}
+	if p.Status != nil {
+		e.Status = *p.Status
+		if e.Status == "" {
+			e.Status = StatusConfirmed
+		}
+	}
+	return e
+}
+
+// inZone returns t in loc: the same instant or, for a patch of LocalTimes, the same clock time.
+func (p Patch) inZone(t time.Time, loc *time.Location) time.Time {
+	if !p.LocalTimes {
+		return t.In(loc)
+	}
+	year, month, day := t.Date()
+	hour, minute, second := t.Clock()
+	return time.Date(year, month, day, hour, minute, second, t.Nanosecond(), loc)
+}
+
+// eventKey identifies an event among the events of all users.
+type eventKey struct {
+	UserID int
+	ID     int
+}
+
+// key returns the storage key of the event.
+func (e Event) key() eventKey {
+	return eventKey{UserID: e.UserID, ID: e.ID}
+}
+
+// locations caches the time zones loaded by name.
+var locations sync.Map
+
+// localize returns the event with all its times in the event's time zone. JSON keeps only the UTC offset
+// of a time, so the zone has to be restored by name after an event is decoded. An unknown zone leaves the times as they are.
+func (e Event) localize() Event {
+	if e.TimeZone == "" {
+		return e
+	}
+
+	var loc *time.Location
+	if cached, ok := locations.Load(e.TimeZone); ok {
+		loc = cached.(*time.Location)
+	} else {
+		var err error
+		if loc, err = time.LoadLocation(e.TimeZone); err != nil {
+			return e
+		}
+		locations.Store(e.TimeZone, loc)
+	}
+
+	e.Date = e.Date.In(loc)
+	if e.End != nil {
+		end := e.End.In(loc)
+		e.End = &end
+	}
+	if e.Recurrence != nil && e.Recurrence.Until != nil {
+		rule := *e.Recurrence
+		until := rule.Until.In(loc)
+		rule.Until = &until
+		e.Recurrence = &rule
+	}
+	if len(e.Exceptions) > 0 {
+		exceptions := make([]Exception, len(e.Exceptions))
+		for i, exception := range e.Exceptions {
+			exception.Occurrence = exception.Occurrence.In(loc)
+			if exception.Date != nil {
+				date := exception.Date.In(loc)
+				exception.Date = &date
+			}
+			exceptions[i] = exception
+		}
+		e.Exceptions = exceptions
+	}
+	return e
 }
@@ -0,0 +1,298 @@
+package calendar
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+const (
+	journalFile  = "journal.log"
+	snapshotFile = "snapshot.json"
+
+	opPut    = "put"
+	opDelete = "delete"
+
+	// defaultSnapshotEvery is used when no positive snapshot interval is given.
+	defaultSnapshotEvery = 1000
+)
+
+// record is a single journal entry. A put record carries the full event as it is after the change,
+// so replaying the journal on top of any older snapshot always converges to the same state.
+type record struct {
+	Op    string `json:"op"`
+	Event Event  `json:"event"`
+}
+
+// snapshot is the content of the snapshot file: every stored event, and the next free event ID of every user,
+// so that the IDs of deleted events are not given out again once their records are compacted away.
+type snapshot struct {
+	Events []Event     `json:"events"`
+	NextID map[int]int `json:"next_id"`
+}
+
+// journal is an append-only log of calendar changes plus a snapshot file that the log is
+// periodically compacted into. Both live in the same directory.
+type journal struct {
+	dir           string
+	file          *os.File
+	records       int // Records written since the last snapshot.
+	snapshotEvery int
+}
+
+// openJournal restores the state from dir by passing every snapshotted event and every journal
+// record to apply, and the snapshotted next free IDs to reserve, and returns the journal ready for appending. A truncated or unreadable last record,
+// as left by a crash in the middle of a write, is cut off; damage anywhere else is reported as an error.
+func openJournal(dir string, snapshotEvery int, apply func(record), reserve func(userID, next int)) (*journal, error) {
+	if snapshotEvery <= 0 {
+		snapshotEvery = defaultSnapshotEvery
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory %s: %w", dir, err)
+	}
+
+	if err := loadSnapshot(filepath.Join(dir, snapshotFile), apply, reserve); err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(dir, journalFile)
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal %s: %w", path, err)
+	}
+
+	records, err := replay(file, apply)
+	if err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("failed to replay journal %s: %w", path, err)
+	}
+
+	return &journal{
+		dir:           dir,
+		file:          file,
+		records:       records,
+		snapshotEvery: snapshotEvery,
+	}, nil
+}
+
+// check verifies that the journal file is still accessible and that new files can be written to the directory,
+// as the next compaction will need to.
+func (j *journal) check() error {
+	if _, err := j.file.Stat(); err != nil {
+		return fmt.Errorf("journal is not accessible: %w", err)
+	}
+
+	probe, err := os.CreateTemp(j.dir, ".health-*")
+	if err != nil {
+		return fmt.Errorf("storage directory %s is not writable: %w", j.dir, err)
+	}
+	_ = probe.Close()
+	return os.Remove(probe.Name())
+}
+
+// loadSnapshot passes every event of the snapshot file to apply and every next free ID to reserve.
+// A missing snapshot is not an error; a snapshot written before the IDs were kept is a bare array of events.
+func loadSnapshot(path string, apply func(record), reserve func(userID, next int)) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read snapshot %s: %w", path, err)
+	}
+
+	var content snapshot
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		err = json.Unmarshal(data, &content.Events)
+	} else {
+		err = json.Unmarshal(data, &content)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse snapshot %s: %w", path, err)
+	}
+	for _, event := range content.Events {
+		apply(record{Op: opPut, Event: event})
+	}
+	for userID, next := range content.NextID {
+		reserve(userID, next)
+	}
+	return nil
+}
+
+// replay reads the journal from the beginning, passes every valid record to apply and leaves
+// the file positioned right after the last valid record, truncating whatever follows it.
+func replay(file *os.File, apply func(record)) (int, error) {
+	records := 0
+	err := readLines(file, func(line []byte) error {
+		batch, err := decodeRecords(line)
+		if err != nil {
+			return err
+		}
+		for _, rec := range batch {
+			apply(rec)
+		}
+		records += len(batch)
+		return nil
+	})
+	return records, err
+}
+
+// readLines passes every line of the file, without the line break, to decode and leaves the file positioned
+// right after the last line decoded, truncating whatever follows it. Only the very last line may be incomplete
+// or fail to decode, as left by a crash in the middle of a write; damage anywhere else is reported as an error.
+func readLines(file *os.File, decode func(line []byte) error) error {
+	reader := bufio.NewReader(file)
+	var offset int64
+
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			return readErr
+		}
+		if len(line) == 0 {
+			break
+		}
+
+		complete := line[len(line)-1] == '\n'
+		if !complete || decode(bytes.TrimSpace(line)) != nil {
+			if _, err := reader.Peek(1); err != io.EOF {
+				return fmt.Errorf("corrupt record at offset %d", offset)
+			}
+			log.Printf("Discarding truncated record at offset %d of %s", offset, file.Name())
+			break
+		}
+		offset += int64(len(line))
+	}
+
+	if err := file.Truncate(offset); err != nil {
+		return err
+	}
+	_, err := file.Seek(offset, io.SeekStart)
+	return err
+}
+
+// decodeRecords decodes a journal line: a single record, or the array of records written together.
+func decodeRecords(line []byte) ([]record, error) {
+	if len(line) > 0 && line[0] == '[' {
+		var records []record
+		err := json.Unmarshal(line, &records)
+		return records, err
+	}
+	var rec record
+	err := json.Unmarshal(line, &rec)
+	return []record{rec}, err
+}
+
+// append durably writes records to the end of the journal. Several records are written as a single line
+// holding their array, so that replay sees either all of them or, after a crash, none. If the write fails,
+// whatever part of the line was written is cut off again, so that later records do not follow a damaged one.
+func (j *journal) append(records ...record) error {
+	var data []byte
+	var err error
+	if len(records) == 1 {
+		data, err = json.Marshal(records[0])
+	} else {
+		data, err = json.Marshal(records)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to encode journal record: %w", err)
+	}
+	if err = appendLine(j.file, data); err != nil {
+		return fmt.Errorf("failed to append journal record: %w", err)
+	}
+	j.records += len(records)
+	return nil
+}
+
+// appendLine durably writes data as a line at the current position of the file, which is its end.
+// If the write or the sync fails, whatever part of the line was written is cut off again.
+func appendLine(file *os.File, data []byte) error {
+	offset, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(append(data, '\n')); err == nil {
+		err = file.Sync()
+	}
+	if err != nil {
+		return rollback(file, offset, err)
+	}
+	return nil
+}
+
+// rollback cuts the file back to offset after a failed append and returns the error of the append,
+// joined with the error of the rollback, if any.
+func rollback(file *os.File, offset int64, err error) error {
+	if truncErr := file.Truncate(offset); truncErr != nil {
+		return errors.Join(err, fmt.Errorf("failed to cut off the partial line: %w", truncErr))
+	}
+	if _, seekErr := file.Seek(offset, io.SeekStart); seekErr != nil {
+		return errors.Join(err, fmt.Errorf("failed to rewind: %w", seekErr))
+	}
+	return err
+}
+
+// snapshotDue reports whether enough records have accumulated to compact the journal.
+func (j *journal) snapshotDue() bool {
+	return j.records >= j.snapshotEvery
+}
+
+// compact atomically replaces the snapshot with content and empties the journal.
+// If the process dies between the two steps, the leftover records are simply replayed again.
+func (j *journal) compact(content snapshot) error {
+	data, err := json.Marshal(content)
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+
+	path := filepath.Join(j.dir, snapshotFile)
+	tmp := path + ".tmp"
+	if err = writeFileSync(tmp, data); err != nil {
+		return fmt.Errorf("failed to write snapshot %s: %w", tmp, err)
+	}
+	if err = os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to replace snapshot %s: %w", path, err)
+	}
+
+	if err = j.file.Truncate(0); err != nil {
+		return fmt.Errorf("failed to truncate journal: %w", err)
+	}
+	if _, err = j.file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to rewind journal: %w", err)
+	}
+	j.records = 0
+	return nil
+}
+
+// close compacts the journal into a final snapshot and closes the file.
+func (j *journal) close(content snapshot) error {
+	err := j.compact(content)
+	if closeErr := j.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// writeFileSync writes data to the named file and flushes it to disk before returning.
+func writeFileSync(name string, data []byte) error {
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(data); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err = file.Sync(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
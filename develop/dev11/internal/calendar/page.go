@@ -0,0 +1,104 @@
+package calendar
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+)
+
+// SortOrder is the order of the events in a listing.
+type SortOrder string
+
+// Orders of a listing.
+const (
+	SortByDate  SortOrder = "date"  // By date, then by ID.
+	SortByTitle SortOrder = "title" // By title ignoring case, then by date and ID.
+)
+
+// ListOptions select a page of a listing: the events whose title contains Query, ignoring case, sorted by Sort,
+// that come after the cursor After, at most Limit of them. A zero Limit means no limit.
+type ListOptions struct {
+	Limit int
+	Sort  SortOrder
+	Query string
+	After *Cursor
+}
+
+// Cursor is the position of the last event of a page, from which the next page continues.
+// As it holds the sort key rather than an offset, events created or deleted meanwhile do not shift the pages.
+type Cursor struct {
+	Sort  SortOrder `json:"s"`
+	Title string    `json:"t,omitempty"`
+	Date  time.Time `json:"d"`
+	ID    int       `json:"i"`
+}
+
+// cursorOf returns the cursor positioned at the event.
+func cursorOf(event Event, sort SortOrder) Cursor {
+	cursor := Cursor{Sort: sort, Date: event.Date, ID: event.ID}
+	if sort == SortByTitle {
+		cursor.Title = strings.ToLower(event.Title)
+	}
+	return cursor
+}
+
+// compare orders two cursors of the same sort order.
+func (c Cursor) compare(other Cursor) int {
+	if c.Sort == SortByTitle {
+		if n := strings.Compare(c.Title, other.Title); n != 0 {
+			return n
+		}
+	}
+	if n := c.Date.Compare(other.Date); n != 0 {
+		return n
+	}
+	return c.ID - other.ID
+}
+
+// Token encodes the cursor as an opaque page token.
+func (c Cursor) Token() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// ParseCursor decodes a page token made by Cursor.Token.
+func ParseCursor(token string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, errors.New("invalid page token")
+	}
+	var cursor Cursor
+	if err = json.Unmarshal(data, &cursor); err != nil || (cursor.Sort != SortByDate && cursor.Sort != SortByTitle) {
+		return nil, errors.New("invalid page token")
+	}
+	return &cursor, nil
+}
+
+// Paginate returns the page of the events selected by the options, with the token of the next page
+// if more events follow. The options are expected to be valid, with a cursor of the same sort order.
+func Paginate(events []Event, options ListOptions) Result {
+	query := strings.ToLower(options.Query)
+	var selected []Event
+	for _, event := range events {
+		if query != "" && !strings.Contains(strings.ToLower(event.Title), query) {
+			continue
+		}
+		if options.After != nil && cursorOf(event, options.Sort).compare(*options.After) <= 0 {
+			continue
+		}
+		selected = append(selected, event)
+	}
+
+	slices.SortStableFunc(selected, func(a, b Event) int {
+		return cursorOf(a, options.Sort).compare(cursorOf(b, options.Sort))
+	})
+
+	if options.Limit == 0 || len(selected) <= options.Limit {
+		return Result{Result: selected}
+	}
+	page := selected[:options.Limit]
+	return Result{Result: page, NextPageToken: cursorOf(page[len(page)-1], options.Sort).Token()}
+}
@@ -0,0 +1,231 @@
+package calendar
+
+import (
+	"errors"
+	"time"
+)
+
+// Frequency is the period at which a recurring event repeats.
+type Frequency string
+
+// Frequencies of a recurring event.
+const (
+	Daily   Frequency = "daily"
+	Weekly  Frequency = "weekly"
+	Monthly Frequency = "monthly"
+)
+
+// Recurrence is a subset of the iCalendar RRULE: an event repeats every Interval days, weeks or months,
+// weekly events on the weekdays listed in ByDay and monthly events on the day of month of the event date.
+// The series ends after Count occurrences or at Until, whichever is given; without either it never ends.
+type Recurrence struct {
+	Freq     Frequency      `json:"freq"`
+	Interval int            `json:"interval,omitempty"` // 0 is the same as 1.
+	ByDay    []time.Weekday `json:"by_day,omitempty"`   // Weekly only; defaults to the weekday of the event date.
+	Count    int            `json:"count,omitempty"`
+	Until    *time.Time     `json:"until,omitempty"` // Inclusive.
+}
+
+// Exception changes a single occurrence of a recurring event, identified by its original start:
+// the occurrence is either cancelled or moved to Date.
+type Exception struct {
+	Occurrence time.Time  `json:"occurrence"`
+	Cancelled  bool       `json:"cancelled,omitempty"`
+	Date       *time.Time `json:"date,omitempty"`
+}
+
+// Validate checks that the rule is well-formed.
+func (r *Recurrence) Validate() error {
+	switch r.Freq {
+	case Daily, Weekly, Monthly:
+	default:
+		return errors.New("frequency must be daily, weekly or monthly")
+	}
+	if r.Interval < 0 {
+		return errors.New("interval must not be negative")
+	}
+	if r.Count < 0 {
+		return errors.New("count must not be negative")
+	}
+	if r.Count > 0 && r.Until != nil {
+		return errors.New("count and until are mutually exclusive")
+	}
+	if len(r.ByDay) > 0 && r.Freq != Weekly {
+		return errors.New("weekdays can only be given for weekly events")
+	}
+	for _, day := range r.ByDay {
+		if day < time.Sunday || day > time.Saturday {
+			return errors.New("invalid weekday")
+		}
+	}
+	return nil
+}
+
+// each calls yield for every occurrence of a series starting at start, in chronological order,
+// until an occurrence at or after to is reached or yield returns false. Nothing is materialized,
+// and when the series is not limited by Count the periods wholly before from are skipped.
+func (r *Recurrence) each(start, from, to time.Time, yield func(time.Time) bool) {
+	interval := max(r.Interval, 1)
+	period := 0
+	if r.Count == 0 {
+		period = r.periodsBefore(start, from) / interval * interval
+	}
+
+	n := 0
+	for ; ; period += interval {
+		base, occurrences := r.period(start, period)
+		if !base.Before(to) {
+			return
+		}
+		for _, occurrence := range occurrences {
+			if occurrence.Before(start) {
+				continue
+			}
+			if !occurrence.Before(to) || (r.Until != nil && occurrence.After(*r.Until)) {
+				return
+			}
+			if r.Count > 0 && n >= r.Count {
+				return
+			}
+			n++
+			if !yield(occurrence) {
+				return
+			}
+		}
+	}
+}
+
+// period returns the beginning of the n-th period after the one containing start, together with
+// the candidate occurrences within it. Days of month that do not exist in a month are skipped.
+func (r *Recurrence) period(start time.Time, n int) (time.Time, []time.Time) {
+	year, month, day := start.Date()
+	hour, minute, sec := start.Clock()
+	at := func(y int, m time.Month, d int) time.Time {
+		return time.Date(y, m, d, hour, minute, sec, start.Nanosecond(), start.Location())
+	}
+
+	switch r.Freq {
+	case Weekly:
+		monday := day - (int(start.Weekday())+6)%7 + 7*n
+		base := time.Date(year, month, monday, 0, 0, 0, 0, start.Location())
+		days := r.ByDay
+		if len(days) == 0 {
+			days = []time.Weekday{start.Weekday()}
+		}
+		var occurrences []time.Time
+		for offset := 0; offset < 7; offset++ {
+			date := at(year, month, monday+offset)
+			for _, d := range days {
+				if date.Weekday() == d {
+					occurrences = append(occurrences, date)
+					break
+				}
+			}
+		}
+		return base, occurrences
+	case Monthly:
+		base := time.Date(year, month+time.Month(n), 1, 0, 0, 0, 0, start.Location())
+		date := at(year, month+time.Month(n), day)
+		if date.Month() != base.Month() {
+			return base, nil
+		}
+		return base, []time.Time{date}
+	default:
+		date := at(year, month, day+n)
+		return startOfDay(date), []time.Time{date}
+	}
+}
+
+// periodsBefore returns roughly how many whole periods separate start from t; it never overshoots.
+func (r *Recurrence) periodsBefore(start, t time.Time) int {
+	if !t.After(start) {
+		return 0
+	}
+	days := int(t.Sub(start).Hours()/24) - 1
+	switch r.Freq {
+	case Weekly:
+		days /= 7
+	case Monthly:
+		days /= 31
+	}
+	return max(days, 0)
+}
+
+// occurrencesIn returns the instances of the event that start in [from, to). A one-off event is returned as is;
+// the instances of a recurring event carry their own dates, with cancelled and moved occurrences applied.
+func (e Event) occurrencesIn(from, to time.Time) []Event {
+	if e.Recurrence == nil {
+		if !e.Date.Before(from) && e.Date.Before(to) {
+			return []Event{e}
+		}
+		return nil
+	}
+
+	var result []Event
+	e.Recurrence.each(e.Date, from, to, func(occurrence time.Time) bool {
+		if occurrence.Before(from) {
+			return true
+		}
+		if exception := e.exception(occurrence); exception == nil {
+			result = append(result, e.instance(occurrence, occurrence))
+		}
+		return true
+	})
+
+	for _, exception := range e.Exceptions {
+		if exception.Date != nil && !exception.Date.Before(from) && exception.Date.Before(to) {
+			result = append(result, e.instance(exception.Occurrence, *exception.Date))
+		}
+	}
+	return result
+}
+
+// occurrencesOverlapping returns the instances of the event that take place, at least partly, in [from, to):
+// those that start before to and end after from. An event without an end overlaps the interval if it starts in it.
+func (e Event) occurrencesOverlapping(from, to time.Time) []Event {
+	duration := e.Duration()
+	if duration <= 0 {
+		return e.occurrencesIn(from, to)
+	}
+
+	var result []Event
+	for _, instance := range e.occurrencesIn(from.Add(-duration), to) {
+		if instance.End.After(from) {
+			result = append(result, instance)
+		}
+	}
+	return result
+}
+
+// instance returns the occurrence of the event that originally started at occurrence and now starts at date.
+// The occurrence lasts as long as the event.
+func (e Event) instance(occurrence, date time.Time) Event {
+	if e.End != nil {
+		end := date.Add(e.Duration())
+		e.End = &end
+	}
+	e.Date = date
+	e.Occurrence = &occurrence
+	e.Exceptions = nil
+	return e
+}
+
+// exception returns the exception for the occurrence, or nil if it takes place as scheduled.
+func (e Event) exception(occurrence time.Time) *Exception {
+	for i := range e.Exceptions {
+		if e.Exceptions[i].Occurrence.Equal(occurrence) {
+			return &e.Exceptions[i]
+		}
+	}
+	return nil
+}
+
+// hasOccurrence reports whether the series has an occurrence originally starting at t.
+func (e Event) hasOccurrence(t time.Time) bool {
+	found := false
+	e.Recurrence.each(e.Date, t, t.Add(time.Nanosecond), func(occurrence time.Time) bool {
+		found = occurrence.Equal(t)
+		return !found
+	})
+	return found
+}
@@ -0,0 +1,97 @@
+package calendar
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+)
+
+// Limits of the reminders of an event.
+const (
+	MaxReminders       = 5
+	MaxReminderMinutes = 4 * 7 * 24 * 60 // Four weeks.
+)
+
+// DueReminder is a reminder whose time has come. Event is the occurrence the reminder is about,
+// with Occurrence set for the instances of recurring events; the reminder fell due at FireAt, Before its start.
+type DueReminder struct {
+	Event  Event
+	Before time.Duration
+	FireAt time.Time
+}
+
+// ValidateReminders checks the reminders of an event, given in minutes before its start.
+func ValidateReminders(minutes []int) error {
+	if len(minutes) > MaxReminders {
+		return fmt.Errorf("an event can have at most %d reminders", MaxReminders)
+	}
+	for i, m := range minutes {
+		if m < 0 || m > MaxReminderMinutes {
+			return fmt.Errorf("reminders must be between 0 and %d minutes before the event", MaxReminderMinutes)
+		}
+		if slices.Contains(minutes[:i], m) {
+			return fmt.Errorf("duplicate reminder %d minutes before the event", m)
+		}
+	}
+	return nil
+}
+
+// DueReminders returns the reminders of all users that are due at now and have not been marked as delivered,
+// sorted by the time they fell due. Cancelled events have no reminders. A reminder stays due until its occurrence
+// has been under way for longer than grace, which lets a caller checking every grace deliver the reminders
+// falling due between two checks, such as those 0 minutes before the start. A reminder whose occurrence started
+// earlier, e.g. because the server was down, is skipped.
+func (c *Calendar) DueReminders(now time.Time, grace time.Duration) []DueReminder {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var due []DueReminder
+	for _, event := range c.events {
+		if len(event.Reminders) == 0 || event.Status == StatusCancelled {
+			continue
+		}
+
+		longest := time.Duration(slices.Max(event.Reminders)) * time.Minute
+		for _, occurrence := range event.occurrencesIn(now.Add(-grace), now.Add(longest+time.Nanosecond)) {
+			for _, minutes := range event.Reminders {
+				before := time.Duration(minutes) * time.Minute
+				fireAt := occurrence.Date.Add(-before)
+				if fireAt.After(now) || (event.RemindedUntil != nil && !fireAt.After(*event.RemindedUntil)) {
+					continue
+				}
+				due = append(due, DueReminder{Event: occurrence, Before: before, FireAt: fireAt})
+			}
+		}
+	}
+
+	sort.Slice(due, func(i, j int) bool {
+		if !due[i].FireAt.Equal(due[j].FireAt) {
+			return due[i].FireAt.Before(due[j].FireAt)
+		}
+		if due[i].Event.UserID != due[j].Event.UserID {
+			return due[i].Event.UserID < due[j].Event.UserID
+		}
+		return due[i].Event.ID < due[j].Event.ID
+	})
+	return due
+}
+
+// MarkReminded records that the reminders of the event that fell due up to at have been delivered,
+// so DueReminders does not return them again, even after a file-backed calendar is reopened.
+// The version of the event does not change, as the event itself is not modified.
+func (c *Calendar) MarkReminded(userID, ID int, at time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	event, ok := c.events[eventKey{UserID: userID, ID: ID}]
+	if !ok {
+		return ErrNoSuchEvent
+	}
+	if event.RemindedUntil != nil && !at.After(*event.RemindedUntil) {
+		return nil
+	}
+
+	event.RemindedUntil = &at
+	return c.commit(record{Op: opPut, Event: event})
+}
@@ -0,0 +1,58 @@
+package calendar
+
+import (
+	"slices"
+	"time"
+)
+
+// Slot is a free window of time, from Start up to End.
+type Slot struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// FreeSlots returns the windows within [from, to) that are not taken by any of the busy events
+// and last at least duration, in chronological order. Events without an end and cancelled events take no time.
+func FreeSlots(busy []Event, from, to time.Time, duration time.Duration) []Slot {
+	busy = slices.DeleteFunc(slices.Clone(busy), func(e Event) bool {
+		return e.End == nil || e.Status == StatusCancelled
+	})
+	sortEvents(busy)
+
+	var slots []Slot
+	free := from
+	for _, event := range busy {
+		if event.Date.After(free) {
+			slots = appendSlot(slots, free, minTime(event.Date, to), duration)
+		}
+		free = maxTime(free, *event.End)
+		if !free.Before(to) {
+			return slots
+		}
+	}
+	return appendSlot(slots, free, to, duration)
+}
+
+// appendSlot appends the window from start to end if it lasts at least duration.
+func appendSlot(slots []Slot, start, end time.Time, duration time.Duration) []Slot {
+	if end.Sub(start) >= duration && end.After(start) {
+		slots = append(slots, Slot{Start: start, End: end})
+	}
+	return slots
+}
+
+// minTime returns the earlier of two times.
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+// maxTime returns the later of two times.
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,219 @@
+package calendar
+
+import (
+	"fmt"
+	"time"
+)
+
+// Operation is a single change of a transaction. Op is ChangeCreate, ChangeUpdate or ChangeDelete:
+// a create adds Event as CreateEvent does, an update applies Patch to the user's event ID as UpdateEvent does,
+// requiring it to be at Version unless that is zero, and a delete moves the user's event ID to the trash.
+type Operation struct {
+	Op      string
+	Event   *Event
+	UserID  int
+	ID      int
+	Patch   Patch
+	Version int
+}
+
+// OperationError reports which operation of a transaction failed and why.
+type OperationError struct {
+	Index int
+	Err   error
+}
+
+// Error names the failed operation and the reason.
+func (e *OperationError) Error() string {
+	return fmt.Sprintf("operation %d: %v", e.Index, e.Err)
+}
+
+// Unwrap returns the error of the operation.
+func (e *OperationError) Unwrap() error {
+	return e.Err
+}
+
+// Transaction applies the operations in order, all of them or none: if an operation fails, an *OperationError
+// is returned and the calendar is left as it was. Later operations see the changes of earlier ones, so an event
+// created by the transaction can be updated by it too. On success it returns, for every operation,
+// the event as created or updated, or as moved to the trash. A file-backed calendar journals
+// the whole transaction as a single record, so that it also survives a crash either whole or not at all.
+func (c *Calendar) Transaction(ops []Operation) ([]Event, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	tx := c.stage()
+	results := make([]Event, len(ops))
+	for i, op := range ops {
+		var err error
+		switch op.Op {
+		case ChangeCreate:
+			if op.Event == nil {
+				err = fmt.Errorf("%w: no event to create", ErrInvalidEvent)
+				break
+			}
+			created := *op.Event
+			if err = tx.create(&created); err == nil {
+				results[i] = tx.changes[len(tx.changes)-1].event
+			}
+		case ChangeUpdate:
+			results[i], err = tx.update(op.UserID, op.ID, op.Patch, op.Version)
+		case ChangeDelete:
+			results[i], err = tx.delete(op.UserID, op.ID)
+		default:
+			err = fmt.Errorf("unknown operation %q", op.Op)
+		}
+		if err != nil {
+			return nil, &OperationError{Index: i, Err: err}
+		}
+	}
+
+	if err := c.commitStaged(tx); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// staged holds the changes of the operations made so far that are not committed yet,
+// so that the next operation can see them.
+type staged struct {
+	c       *Calendar
+	events  map[eventKey]*Event // Changed events; nil marks a deleted one.
+	nextID  map[int]int         // Next free event ID per user, where the changes moved it.
+	records []record
+	changes []stagedChange
+}
+
+// stagedChange is a change of an event to be reported once the staged records are committed.
+type stagedChange struct {
+	changeType string
+	before     *Event // nil for a created event.
+	event      Event
+}
+
+// stage starts staging changes on top of the calendar. The caller must hold c.mu.
+func (c *Calendar) stage() *staged {
+	return &staged{c: c, events: make(map[eventKey]*Event), nextID: make(map[int]int)}
+}
+
+// lookup returns the event with the key as it is after the staged changes.
+func (s *staged) lookup(key eventKey) (Event, bool) {
+	if event, ok := s.events[key]; ok {
+		if event == nil {
+			return Event{}, false
+		}
+		return *event, true
+	}
+	event, ok := s.c.events[key]
+	return event, ok
+}
+
+// taken reports whether the key belongs to an event, either stored or in the trash, after the staged changes.
+func (s *staged) taken(key eventKey) bool {
+	if _, ok := s.events[key]; ok {
+		// Staged deletions move events to the trash as well.
+		return true
+	}
+	_, stored := s.c.events[key]
+	_, trashed := s.c.trash[key]
+	return stored || trashed
+}
+
+// put stages a record that stores the event, and the change it makes to the event from before.
+func (s *staged) put(changeType string, before *Event, event Event) Event {
+	s.records = append(s.records, record{Op: opPut, Event: event})
+	event = event.localize()
+	s.events[event.key()] = &event
+	if event.ID >= s.allocateID(event.UserID) {
+		s.nextID[event.UserID] = event.ID + 1
+	}
+	s.changes = append(s.changes, stagedChange{changeType: changeType, before: before, event: event})
+	return event
+}
+
+// create stages the creation of the event, filling in its ID, version and status; see CreateEvent.
+func (s *staged) create(event *Event) error {
+	if err := event.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidEvent, err)
+	}
+
+	created := *event
+	created.TimeZone = created.Date.Location().String()
+	created.Version = 1
+	if created.Status == "" {
+		created.Status = StatusConfirmed
+	}
+	if created.ID == 0 {
+		created.ID = s.allocateID(created.UserID)
+	} else if s.taken(created.key()) {
+		return ErrEventExists
+	}
+
+	s.put(ChangeCreate, nil, created)
+	event.ID, event.Version, event.Status = created.ID, created.Version, created.Status
+	return nil
+}
+
+// update stages a patch of the user's event and returns the updated event; see UpdateEvent.
+func (s *staged) update(userID, ID int, patch Patch, version int) (Event, error) {
+	event, ok := s.lookup(eventKey{UserID: userID, ID: ID})
+	if !ok {
+		return Event{}, ErrNoSuchEvent
+	}
+	if version != 0 && event.Version != version {
+		return Event{}, ErrVersionMismatch
+	}
+
+	before := event
+	event = patch.Apply(event)
+	if err := event.Validate(); err != nil {
+		return Event{}, fmt.Errorf("%w: %v", ErrInvalidEvent, err)
+	}
+	if event.RemindedUntil != nil && (!event.Date.Equal(before.Date) || patch.Reminders != nil) {
+		// The moved reminders that already fell due were either delivered at their old times or are too late now.
+		now := time.Now()
+		event.RemindedUntil = &now
+	}
+	event.Version++
+	return s.put(ChangeUpdate, &before, event), nil
+}
+
+// delete stages moving the user's event to the trash and returns the event as trashed.
+func (s *staged) delete(userID, ID int) (Event, error) {
+	key := eventKey{UserID: userID, ID: ID}
+	event, ok := s.lookup(key)
+	if !ok {
+		return Event{}, ErrNoSuchEvent
+	}
+
+	before := event
+	now := time.Now()
+	event.DeletedAt = &now
+	s.records = append(s.records, record{Op: opPut, Event: event})
+	s.events[key] = nil
+	s.changes = append(s.changes, stagedChange{changeType: ChangeDelete, before: &before, event: event})
+	return event, nil
+}
+
+// allocateID returns the next free ID of the user, counting the staged events.
+func (s *staged) allocateID(userID int) int {
+	if next, ok := s.nextID[userID]; ok {
+		return next
+	}
+	return s.c.allocateID(userID)
+}
+
+// commitStaged commits the staged records at once and then reports the staged changes to the listeners.
+// The caller must hold c.mu.
+func (c *Calendar) commitStaged(s *staged) error {
+	if len(s.records) == 0 {
+		return nil
+	}
+	if err := c.commit(s.records...); err != nil {
+		return err
+	}
+	for _, change := range s.changes {
+		c.notify(change.changeType, change.before, change.event)
+	}
+	return nil
+}
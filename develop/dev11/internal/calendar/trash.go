@@ -0,0 +1,67 @@
+package calendar
+
+import "time"
+
+// Trash returns the user's deleted events that have not been purged yet, as stored,
+// sorted by the date of the (first) occurrence.
+func (c *Calendar) Trash(userID int) []Event {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var result []Event
+	for _, event := range c.trash {
+		if event.UserID == userID {
+			result = append(result, event)
+		}
+	}
+	sortEvents(result)
+	return result
+}
+
+// RestoreEvent moves the user's event back from the trash and returns the restored event.
+// The event gets a new version, so that updates based on the version it was deleted at fail.
+func (c *Calendar) RestoreEvent(userID, ID int) (*Event, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	trashed, ok := c.trash[eventKey{UserID: userID, ID: ID}]
+	if !ok {
+		return nil, ErrNoSuchEvent
+	}
+	event := trashed
+	event.DeletedAt = nil
+	event.Version++
+
+	if err := c.commit(record{Op: opPut, Event: event}); err != nil {
+		return nil, err
+	}
+	restored := c.events[event.key()]
+	c.notify(ChangeRestore, &trashed, restored)
+	return &restored, nil
+}
+
+// PurgeTrash permanently removes the events of all users that were deleted before the given time
+// and returns how many were removed. Purges are recorded in the audit log but not reported to the listeners.
+func (c *Calendar) PurgeTrash(before time.Time) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var records []record
+	for _, event := range c.trash {
+		if event.DeletedAt.Before(before) {
+			records = append(records, record{Op: opDelete, Event: event})
+		}
+	}
+	if len(records) == 0 {
+		return 0, nil
+	}
+	if err := c.commit(records...); err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	for _, rec := range records {
+		purged := rec.Event
+		c.record(AuditEntry{Type: AuditPurge, UserID: purged.UserID, ID: purged.ID, Actor: c.actor, At: now, Before: &purged})
+	}
+	return len(records), nil
+}
@@ -0,0 +1,455 @@
+// Package ical converts calendar events to and from the iCalendar format (RFC 5545).
+// Only the properties the calendar can represent are supported: UID, DTSTART, DTEND, SUMMARY, DESCRIPTION,
+// LOCATION, STATUS, ATTENDEE, the DAILY, WEEKLY and MONTHLY subset of RRULE, EXDATE and RECURRENCE-ID.
+// A TZID is taken as the name of an IANA time zone: VTIMEZONE components are written for the zones used but not read.
+package ical
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"dev11/internal/calendar"
+)
+
+const (
+	utcLayout      = "20060102T150405Z"
+	floatingLayout = "20060102T150405"
+	dateLayout     = "20060102"
+
+	maxLineLength = 75 // Octets per line before folding.
+)
+
+// weekdays lists the iCalendar weekday names in the order of time.Weekday.
+var weekdays = [...]string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+// Item is one VEVENT read from an iCalendar stream. If the component could not be converted, Err says why.
+// A component with a RECURRENCE-ID moves that occurrence of the event with the same UID to Event.Date.
+type Item struct {
+	UID          string
+	Event        calendar.Event
+	RecurrenceID *time.Time
+	Err          error
+}
+
+// Encode writes the events as a VCALENDAR, one VEVENT per event plus one per moved occurrence.
+// stamp is used as the DTSTAMP of every component. Times of events with a time zone other than UTC
+// are written as local times with a TZID parameter naming the IANA zone, which is defined by a VTIMEZONE.
+func Encode(w io.Writer, events []calendar.Event, stamp time.Time) error {
+	out := &writer{w: bufio.NewWriter(w)}
+
+	out.line("BEGIN:VCALENDAR")
+	out.line("VERSION:2.0")
+	out.line("PRODID:-//dev11//calendar//EN")
+	var zones zoneSet
+	for _, event := range events {
+		zones.addEvent(event, stamp)
+	}
+	zones.write(out)
+	for _, event := range events {
+		uid := UID(event)
+		out.line("BEGIN:VEVENT")
+		out.line("UID:" + uid)
+		out.line("DTSTAMP:" + formatTime(stamp))
+		out.line(timeProperty("DTSTART", event.Date))
+		if event.End != nil {
+			out.line(timeProperty("DTEND", *event.End))
+		}
+		out.line("SUMMARY:" + escape(event.Title))
+		if event.Description != "" {
+			out.line("DESCRIPTION:" + escape(event.Description))
+		}
+		if event.Location != "" {
+			out.line("LOCATION:" + escape(event.Location))
+		}
+		if event.Status != "" {
+			out.line("STATUS:" + strings.ToUpper(string(event.Status)))
+		}
+		for _, attendee := range event.Attendees {
+			out.line("ATTENDEE:mailto:" + attendee)
+		}
+		if event.Recurrence != nil {
+			out.line("RRULE:" + formatRule(event.Recurrence))
+			for _, exception := range event.Exceptions {
+				if exception.Cancelled {
+					out.line(timeProperty("EXDATE", exception.Occurrence))
+				}
+			}
+		}
+		out.line("END:VEVENT")
+
+		for _, exception := range event.Exceptions {
+			if exception.Date == nil {
+				continue
+			}
+			out.line("BEGIN:VEVENT")
+			out.line("UID:" + uid)
+			out.line("DTSTAMP:" + formatTime(stamp))
+			out.line(timeProperty("RECURRENCE-ID", exception.Occurrence))
+			out.line(timeProperty("DTSTART", *exception.Date))
+			if event.End != nil {
+				out.line(timeProperty("DTEND", exception.Date.Add(event.Duration())))
+			}
+			out.line("SUMMARY:" + escape(event.Title))
+			out.line("END:VEVENT")
+		}
+	}
+	out.line("END:VCALENDAR")
+
+	if out.err != nil {
+		return out.err
+	}
+	return out.w.Flush()
+}
+
+// UID returns the iCalendar UID under which the event is exported.
+func UID(event calendar.Event) string {
+	return fmt.Sprintf("%d-%d@dev11", event.UserID, event.ID)
+}
+
+// Decode reads all VEVENT components of a VCALENDAR. Problems with a single component are reported
+// in its Item; an error is returned only if the stream as a whole is not an iCalendar object.
+// Floating times, which carry neither a UTC marker nor a TZID, are taken in loc.
+func Decode(r io.Reader, loc *time.Location) ([]Item, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 || !strings.EqualFold(lines[0], "BEGIN:VCALENDAR") {
+		return nil, errors.New("not an iCalendar object: missing BEGIN:VCALENDAR")
+	}
+
+	var items []Item
+	var component []property
+	inEvent := false
+	depth := 0 // Nesting of components inside the VEVENT, such as VALARM.
+
+	for _, line := range lines[1:] {
+		prop, err := parseProperty(line)
+		if err != nil {
+			if inEvent {
+				component = append(component, property{name: "X-INVALID", value: line})
+			}
+			continue
+		}
+
+		switch {
+		case prop.name == "BEGIN" && !inEvent && strings.EqualFold(prop.value, "VEVENT"):
+			inEvent, component = true, nil
+		case prop.name == "BEGIN" && inEvent:
+			depth++
+		case prop.name == "END" && inEvent && depth > 0:
+			depth--
+		case prop.name == "END" && inEvent:
+			items = append(items, decodeEvent(component, loc))
+			inEvent = false
+		case prop.name == "END" && strings.EqualFold(prop.value, "VCALENDAR"):
+			return items, nil
+		case inEvent && depth == 0:
+			component = append(component, prop)
+		}
+	}
+	return nil, errors.New("not an iCalendar object: missing END:VCALENDAR")
+}
+
+// property is a single content line: NAME;PARAM=VALUE:VALUE.
+type property struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// parseProperty splits a content line into its name, parameters and value.
+func parseProperty(line string) (property, error) {
+	colon := indexOutsideQuotes(line, ':')
+	if colon < 0 {
+		return property{}, fmt.Errorf("invalid content line %q", line)
+	}
+
+	parts := strings.Split(line[:colon], ";")
+	prop := property{
+		name:   strings.ToUpper(parts[0]),
+		params: make(map[string]string),
+		value:  line[colon+1:],
+	}
+	for _, param := range parts[1:] {
+		name, value, _ := strings.Cut(param, "=")
+		prop.params[strings.ToUpper(name)] = strings.Trim(value, `"`)
+	}
+	return prop, nil
+}
+
+// indexOutsideQuotes returns the index of the first c in s that is not inside a quoted parameter value.
+func indexOutsideQuotes(s string, c byte) int {
+	quoted := false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '"':
+			quoted = !quoted
+		case s[i] == c && !quoted:
+			return i
+		}
+	}
+	return -1
+}
+
+// decodeEvent converts the properties of one VEVENT into an Item, taking floating times in loc.
+func decodeEvent(props []property, loc *time.Location) Item {
+	var item Item
+	fail := func(err error) Item {
+		item.Err = err
+		return item
+	}
+
+	var exdates []time.Time
+	var hasStart bool
+	for _, prop := range props {
+		switch prop.name {
+		case "UID":
+			item.UID = prop.value
+		case "SUMMARY":
+			item.Event.Title = unescape(prop.value)
+		case "DESCRIPTION":
+			item.Event.Description = unescape(prop.value)
+		case "LOCATION":
+			item.Event.Location = unescape(prop.value)
+		case "STATUS":
+			item.Event.Status = calendar.Status(strings.ToLower(prop.value))
+		case "ATTENDEE":
+			if address, ok := cutPrefixFold(prop.value, "mailto:"); ok {
+				item.Event.Attendees = append(item.Event.Attendees, address)
+			}
+		case "DTSTART":
+			start, err := parseTime(prop, loc)
+			if err != nil {
+				return fail(fmt.Errorf("DTSTART: %w", err))
+			}
+			item.Event.Date, hasStart = start, true
+		case "DTEND":
+			end, err := parseTime(prop, loc)
+			if err != nil {
+				return fail(fmt.Errorf("DTEND: %w", err))
+			}
+			item.Event.End = &end
+		case "RECURRENCE-ID":
+			occurrence, err := parseTime(prop, loc)
+			if err != nil {
+				return fail(fmt.Errorf("RECURRENCE-ID: %w", err))
+			}
+			item.RecurrenceID = &occurrence
+		case "RRULE":
+			rule, err := parseRule(prop.value, loc)
+			if err != nil {
+				return fail(fmt.Errorf("RRULE: %w", err))
+			}
+			item.Event.Recurrence = rule
+		case "EXDATE":
+			for _, value := range strings.Split(prop.value, ",") {
+				exdate, err := parseTime(property{params: prop.params, value: value}, loc)
+				if err != nil {
+					return fail(fmt.Errorf("EXDATE: %w", err))
+				}
+				exdates = append(exdates, exdate)
+			}
+		case "X-INVALID":
+			return fail(fmt.Errorf("invalid content line %q", prop.value))
+		}
+	}
+
+	switch {
+	case !hasStart:
+		return fail(errors.New("DTSTART is required"))
+	case item.Event.Title == "":
+		return fail(errors.New("SUMMARY is required"))
+	case len(exdates) > 0 && item.Event.Recurrence == nil:
+		return fail(errors.New("EXDATE requires RRULE"))
+	}
+	if err := item.Event.Validate(); err != nil {
+		return fail(err)
+	}
+	for _, exdate := range exdates {
+		item.Event.Exceptions = append(item.Event.Exceptions, calendar.Exception{Occurrence: exdate, Cancelled: true})
+	}
+	return item
+}
+
+// parseTime parses a DATE or DATE-TIME value. UTC times are returned in UTC, times with a TZID parameter
+// in that zone, if it is known, and floating times and dates in loc.
+func parseTime(prop property, loc *time.Location) (time.Time, error) {
+	if tzid := prop.params["TZID"]; tzid != "" {
+		var err error
+		if loc, err = time.LoadLocation(tzid); err != nil {
+			return time.Time{}, fmt.Errorf("unknown time zone %q", tzid)
+		}
+	}
+
+	value := strings.TrimSpace(prop.value)
+	if t, err := time.Parse(utcLayout, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{floatingLayout, dateLayout} {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", value)
+}
+
+// parseRule parses the supported subset of an RRULE value, taking a floating UNTIL in loc.
+func parseRule(value string, loc *time.Location) (*calendar.Recurrence, error) {
+	rule := &calendar.Recurrence{}
+	for _, part := range strings.Split(value, ";") {
+		name, v, _ := strings.Cut(part, "=")
+		var err error
+		switch strings.ToUpper(name) {
+		case "FREQ":
+			rule.Freq = calendar.Frequency(strings.ToLower(v))
+		case "INTERVAL":
+			rule.Interval, err = strconv.Atoi(v)
+		case "COUNT":
+			rule.Count, err = strconv.Atoi(v)
+		case "UNTIL":
+			var until time.Time
+			until, err = parseTime(property{value: v}, loc)
+			rule.Until = &until
+		case "BYDAY":
+			for _, day := range strings.Split(v, ",") {
+				weekday, ok := parseWeekday(day)
+				if !ok {
+					return nil, fmt.Errorf("unsupported BYDAY value %q", day)
+				}
+				rule.ByDay = append(rule.ByDay, weekday)
+			}
+		case "WKST":
+			// Weeks always start on Monday.
+		default:
+			return nil, fmt.Errorf("unsupported rule part %q", name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s value %q", name, v)
+		}
+	}
+
+	if err := rule.Validate(); err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+// parseWeekday converts a two-letter iCalendar weekday name.
+func parseWeekday(name string) (time.Weekday, bool) {
+	for day, n := range weekdays {
+		if strings.EqualFold(name, n) {
+			return time.Weekday(day), true
+		}
+	}
+	return 0, false
+}
+
+// formatRule formats the rule as an RRULE value.
+func formatRule(rule *calendar.Recurrence) string {
+	parts := []string{"FREQ=" + strings.ToUpper(string(rule.Freq))}
+	if rule.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(rule.Interval))
+	}
+	if rule.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(rule.Count))
+	}
+	if rule.Until != nil {
+		parts = append(parts, "UNTIL="+formatTime(*rule.Until))
+	}
+	if len(rule.ByDay) > 0 {
+		days := make([]string, len(rule.ByDay))
+		for i, day := range rule.ByDay {
+			days[i] = weekdays[day]
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	return strings.Join(parts, ";")
+}
+
+// cutPrefixFold returns s without the prefix, which is matched case-insensitively, and reports whether s had it.
+func cutPrefixFold(s, prefix string) (string, bool) {
+	if len(s) < len(prefix) || !strings.EqualFold(s[:len(prefix)], prefix) {
+		return s, false
+	}
+	return s[len(prefix):], true
+}
+
+// timeProperty formats a DATE-TIME property, in UTC or as a local time with TZID.
+func timeProperty(name string, t time.Time) string {
+	if loc := tzid(t); loc != "" {
+		return name + ";TZID=" + loc + ":" + t.Format(floatingLayout)
+	}
+	return name + ":" + formatTime(t)
+}
+
+// tzid returns the TZID t is written with, or "" if it is written in UTC.
+func tzid(t time.Time) string {
+	if loc := t.Location().String(); loc != "UTC" && loc != "Local" && loc != "" {
+		return loc
+	}
+	return ""
+}
+
+// formatTime formats t as a UTC DATE-TIME value.
+func formatTime(t time.Time) string {
+	return t.UTC().Format(utcLayout)
+}
+
+// escape escapes a TEXT value.
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// unescape reverses escape.
+func unescape(s string) string {
+	return strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n").Replace(s)
+}
+
+// unfold reads the stream and joins folded content lines, dropping empty ones.
+func unfold(r io.Reader) ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	var lines []string
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(line) > 0 && (line[0] == ' ' || line[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read iCalendar data: %w", err)
+	}
+	return lines, nil
+}
+
+// writer writes CRLF-terminated content lines, folding long ones, and remembers the first error.
+type writer struct {
+	w   *bufio.Writer
+	err error
+}
+
+// line writes one content line, folding it at maxLineLength octets without splitting UTF-8 sequences.
+func (w *writer) line(s string) {
+	limit := maxLineLength
+	for w.err == nil && len(s) > limit {
+		cut := limit
+		for cut > 0 && s[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		_, w.err = w.w.WriteString(s[:cut] + "\r\n ")
+		s = s[cut:]
+		limit = maxLineLength - 1 // The leading space of a continuation line counts too.
+	}
+	if w.err == nil {
+		_, w.err = w.w.WriteString(s + "\r\n")
+	}
+}
@@ -0,0 +1,141 @@
+package ical
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"dev11/internal/calendar"
+)
+
+func TestEncodeDecodeRoundTrip(t *testing.T) {
+	start := time.Date(2025, 1, 20, 10, 0, 0, 0, time.UTC)
+	moved := start.AddDate(0, 0, 2).Add(2 * time.Hour)
+	events := []calendar.Event{
+		{ID: 1, UserID: 7, Title: "Review; notes, and \\ more", Date: start.Add(-time.Hour), End: &start,
+			Description: "Agenda:\n1. Notes", Location: "Room 4, 2nd floor", Status: calendar.StatusTentative,
+			Attendees: []string{"ann@example.com", "bob@example.com"}},
+		{ID: 2, UserID: 7, Title: strings.Repeat("Долгий стендап ", 10), Date: start,
+			Recurrence: &calendar.Recurrence{Freq: calendar.Weekly, Count: 6, ByDay: []time.Weekday{time.Monday, time.Wednesday}},
+			Exceptions: []calendar.Exception{
+				{Occurrence: start.AddDate(0, 0, 7), Cancelled: true},
+				{Occurrence: start.AddDate(0, 0, 2), Date: &moved},
+			}},
+	}
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, events, start); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	for _, line := range strings.Split(buf.String(), "\r\n") {
+		if len(line) > maxLineLength {
+			t.Errorf("line is not folded: %q", line)
+		}
+	}
+
+	items, err := Decode(&buf, time.UTC)
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if len(items) != 3 {
+		t.Fatalf("decoded %d items, want 3", len(items))
+	}
+	for _, item := range items {
+		if item.Err != nil {
+			t.Fatalf("item %s: %v", item.UID, item.Err)
+		}
+	}
+
+	if one := items[0].Event; one.Title != events[0].Title || !one.Date.Equal(events[0].Date) ||
+		one.End == nil || !one.End.Equal(start) || one.Description != events[0].Description ||
+		one.Location != events[0].Location || one.Status != events[0].Status || len(one.Attendees) != 2 {
+		t.Errorf("one-off event = %+v, want %+v", one, events[0])
+	}
+	series := items[1].Event
+	if series.Title != events[1].Title || series.Recurrence == nil || series.Recurrence.Count != 6 ||
+		len(series.Recurrence.ByDay) != 2 || len(series.Exceptions) != 1 {
+		t.Errorf("recurring event = %+v, want %+v", series, events[1])
+	}
+	if items[2].UID != items[1].UID || items[2].RecurrenceID == nil || !items[2].Event.Date.Equal(moved) {
+		t.Errorf("moved occurrence = %+v, want a RECURRENCE-ID override of %s", items[2], items[1].UID)
+	}
+}
+
+func TestDecodeReportsBadItems(t *testing.T) {
+	data := "BEGIN:VCALENDAR\r\n" +
+		"BEGIN:VEVENT\r\nUID:a\r\nDTSTART;TZID=Europe/Moscow:20250116T153000\r\nSUMMARY:ok\r\n" +
+		"BEGIN:VALARM\r\nTRIGGER:-PT15M\r\nEND:VALARM\r\nEND:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\nUID:b\r\nSUMMARY:no start\r\nEND:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\nUID:c\r\nDTSTART:20250116\r\nSUMMARY:yearly\r\nRRULE:FREQ=YEARLY\r\nEND:VEVENT\r\n" +
+		"END:VCALENDAR\r\n"
+
+	items, err := Decode(strings.NewReader(data), time.UTC)
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if len(items) != 3 {
+		t.Fatalf("decoded %d items, want 3", len(items))
+	}
+	if items[0].Err != nil || !items[0].Event.Date.Equal(time.Date(2025, 1, 16, 12, 30, 0, 0, time.UTC)) {
+		t.Errorf("item a = %+v, want a valid event at 12:30 UTC", items[0])
+	}
+	if items[1].Err == nil || items[2].Err == nil {
+		t.Errorf("items b and c were accepted: %v, %v", items[1].Err, items[2].Err)
+	}
+
+	if _, err = Decode(strings.NewReader("hello"), time.UTC); err == nil {
+		t.Error("Decode accepted a stream that is not iCalendar")
+	}
+}
+
+func TestEncodeDefinesTimeZones(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("time zone data is not available:", err)
+	}
+	moscow, _ := time.LoadLocation("Europe/Moscow")
+	stamp := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	events := []calendar.Event{
+		{ID: 1, UserID: 1, Title: "weekly", Date: time.Date(2025, 1, 16, 10, 0, 0, 0, berlin),
+			Recurrence: &calendar.Recurrence{Freq: calendar.Weekly, Until: ptr(time.Date(2025, 12, 31, 0, 0, 0, 0, time.UTC))}},
+		{ID: 2, UserID: 1, Title: "one-off", Date: time.Date(2025, 1, 16, 10, 0, 0, 0, moscow)},
+		{ID: 3, UserID: 1, Title: "utc", Date: time.Date(2025, 1, 16, 10, 0, 0, 0, time.UTC)},
+	}
+
+	var buf bytes.Buffer
+	if err = Encode(&buf, events, stamp); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	data := buf.String()
+	for _, want := range []string{
+		// Every period of the zone from the start of the series to its end.
+		"BEGIN:VTIMEZONE\r\nTZID:Europe/Berlin\r\n" +
+			"BEGIN:STANDARD\r\nDTSTART:20241027T030000\r\nTZOFFSETFROM:+0200\r\nTZOFFSETTO:+0100\r\nTZNAME:CET\r\nEND:STANDARD\r\n" +
+			"BEGIN:DAYLIGHT\r\nDTSTART:20250330T020000\r\nTZOFFSETFROM:+0100\r\nTZOFFSETTO:+0200\r\nTZNAME:CEST\r\nEND:DAYLIGHT\r\n" +
+			"BEGIN:STANDARD\r\nDTSTART:20251026T030000\r\nTZOFFSETFROM:+0200\r\nTZOFFSETTO:+0100\r\nTZNAME:CET\r\nEND:STANDARD\r\n" +
+			"END:VTIMEZONE\r\n",
+		"BEGIN:VTIMEZONE\r\nTZID:Europe/Moscow\r\nBEGIN:STANDARD\r\nDTSTART:20141026T020000\r\n" +
+			"TZOFFSETFROM:+0400\r\nTZOFFSETTO:+0300\r\nTZNAME:MSK\r\nEND:STANDARD\r\nEND:VTIMEZONE\r\n",
+		"DTSTART;TZID=Europe/Berlin:20250116T100000\r\n",
+	} {
+		if !strings.Contains(data, want) {
+			t.Errorf("encoded calendar does not contain %q:\n%s", want, data)
+		}
+	}
+	if n := strings.Count(data, "BEGIN:VTIMEZONE"); n != 2 {
+		t.Errorf("encoded %d VTIMEZONE components, want 2", n)
+	}
+
+	items, err := Decode(&buf, time.UTC)
+	if err != nil || len(items) != 3 {
+		t.Fatalf("Decode = %d items, %v; want the 3 events", len(items), err)
+	}
+	if !items[0].Event.Date.Equal(events[0].Date) {
+		t.Errorf("decoded date = %v, want %v", items[0].Event.Date, events[0].Date)
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,128 @@
+package ical
+
+import (
+	"fmt"
+	"time"
+
+	"dev11/internal/calendar"
+)
+
+// zoneHorizon is how far past the export the VTIMEZONE of an open-ended recurring event reaches.
+const zoneHorizon = 10 // Years.
+
+// zoneSpan is a time zone referenced by TZID together with the interval its VTIMEZONE has to cover.
+type zoneSpan struct {
+	loc      *time.Location
+	from, to time.Time
+}
+
+// zoneSet collects the time zones of the exported times in the order they are first used.
+type zoneSet struct {
+	names []string
+	spans map[string]*zoneSpan
+}
+
+// add records that t is written with a TZID, if it is.
+func (z *zoneSet) add(t time.Time) {
+	name := tzid(t)
+	if name == "" {
+		return
+	}
+	span, ok := z.spans[name]
+	if !ok {
+		if z.spans == nil {
+			z.spans = make(map[string]*zoneSpan)
+		}
+		span = &zoneSpan{loc: t.Location(), from: t, to: t}
+		z.spans[name] = span
+		z.names = append(z.names, name)
+	}
+	if t.Before(span.from) {
+		span.from = t
+	}
+	if t.After(span.to) {
+		span.to = t
+	}
+}
+
+// addEvent records the zones of every time of the event written with a TZID. The zone of a recurring event
+// is covered up to its last occurrence, or for zoneHorizon years past stamp if it has none.
+func (z *zoneSet) addEvent(event calendar.Event, stamp time.Time) {
+	z.add(event.Date)
+	if event.End != nil {
+		z.add(*event.End)
+	}
+	for _, exception := range event.Exceptions {
+		z.add(exception.Occurrence)
+		if exception.Date != nil {
+			z.add(*exception.Date)
+		}
+	}
+	if rule := event.Recurrence; rule != nil {
+		last := stamp.AddDate(zoneHorizon, 0, 0)
+		if rule.Until != nil && rule.Until.Before(last) {
+			last = *rule.Until
+		}
+		z.add(last.In(event.Date.Location()))
+	}
+}
+
+// write writes a VTIMEZONE for every collected zone.
+func (z *zoneSet) write(out *writer) {
+	for _, name := range z.names {
+		span := z.spans[name]
+		out.line("BEGIN:VTIMEZONE")
+		out.line("TZID:" + name)
+		// One observance per period of the zone, from the one in effect at the earliest time
+		// to the one in effect at the latest.
+		t := span.from.In(span.loc)
+		for {
+			start, end := t.ZoneBounds()
+			writeObservance(out, t, start)
+			if end.IsZero() || end.After(span.to) {
+				break
+			}
+			t = end
+		}
+		out.line("END:VTIMEZONE")
+	}
+}
+
+// writeObservance writes the STANDARD or DAYLIGHT observance of the zone period containing t, which began at start.
+// A period with no known beginning is written as beginning in 1970.
+func writeObservance(out *writer, t, start time.Time) {
+	name, offset := t.Zone()
+	previous := offset
+	if !start.IsZero() {
+		_, previous = start.Add(-time.Nanosecond).Zone()
+	}
+
+	kind := "STANDARD"
+	if t.IsDST() {
+		kind = "DAYLIGHT"
+	}
+	out.line("BEGIN:" + kind)
+	if start.IsZero() {
+		out.line("DTSTART:19700101T000000")
+	} else {
+		// DTSTART is the local time at which the period began, as read on the clock of the period before it.
+		out.line("DTSTART:" + start.In(time.FixedZone("", previous)).Format(floatingLayout))
+	}
+	out.line("TZOFFSETFROM:" + formatOffset(previous))
+	out.line("TZOFFSETTO:" + formatOffset(offset))
+	out.line("TZNAME:" + escape(name))
+	out.line("END:" + kind)
+}
+
+// formatOffset formats an offset from UTC in seconds as a UTC-OFFSET value.
+func formatOffset(seconds int) string {
+	sign := '+'
+	if seconds < 0 {
+		sign, seconds = '-', -seconds
+	}
+	value := fmt.Sprintf("%c%02d%02d", sign, seconds/3600, seconds/60%60)
+	if seconds%60 != 0 {
+		value += fmt.Sprintf("%02d", seconds%60)
+	}
+	return value
+}
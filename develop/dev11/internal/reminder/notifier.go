@@ -0,0 +1,100 @@
+// Package reminder delivers the reminders of calendar events: a background scheduler finds the reminders
+// that are due and passes them to a pluggable notifier.
+package reminder
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"dev11/internal/calendar"
+)
+
+// Notification is a reminder about an occurrence of an event.
+type Notification struct {
+	UserID        int        `json:"user_id"`
+	EventID       int        `json:"event_id"`
+	Title         string     `json:"title"`
+	Start         time.Time  `json:"start"`
+	Occurrence    *time.Time `json:"occurrence,omitempty"`
+	MinutesBefore int        `json:"minutes_before"`
+	DueAt         time.Time  `json:"due_at"`
+}
+
+// newNotification describes a due reminder.
+func newNotification(due calendar.DueReminder) Notification {
+	return Notification{
+		UserID:        due.Event.UserID,
+		EventID:       due.Event.ID,
+		Title:         due.Event.Title,
+		Start:         due.Event.Date,
+		Occurrence:    due.Event.Occurrence,
+		MinutesBefore: int(due.Before / time.Minute),
+		DueAt:         due.FireAt,
+	}
+}
+
+// Notifier delivers notifications. A returned error means the notification was not delivered
+// and the scheduler will try again.
+type Notifier interface {
+	Notify(ctx context.Context, notification Notification) error
+}
+
+// LogNotifier writes every notification to a log.
+type LogNotifier struct {
+	Logger *slog.Logger
+}
+
+// Notify logs the notification.
+func (n LogNotifier) Notify(ctx context.Context, notification Notification) error {
+	n.Logger.InfoContext(ctx, "reminder",
+		"user_id", notification.UserID,
+		"event_id", notification.EventID,
+		"title", notification.Title,
+		"start", notification.Start,
+		"minutes_before", notification.MinutesBefore,
+	)
+	return nil
+}
+
+// Webhook posts every notification as a JSON object to a URL. Any 2xx response counts as delivered.
+type Webhook struct {
+	URL    string
+	Client *http.Client
+}
+
+// NewWebhook creates a webhook notifier whose requests time out after timeout.
+func NewWebhook(url string, timeout time.Duration) *Webhook {
+	return &Webhook{URL: url, Client: &http.Client{Timeout: timeout}}
+}
+
+// Notify posts the notification to the webhook.
+func (n *Webhook) Notify(ctx context.Context, notification Notification) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package reminder
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"dev11/internal/calendar"
+)
+
+// Store keeps the events and remembers which of their reminders have been delivered.
+// calendar.Calendar implements it.
+type Store interface {
+	DueReminders(now time.Time, grace time.Duration) []calendar.DueReminder
+	MarkReminded(userID, ID int, at time.Time) error
+}
+
+// Scheduler periodically delivers the due reminders of the store through the notifier.
+// A reminder is marked as delivered only after the notifier accepts it, so a failed delivery is retried
+// on the next tick, while a delivered one is never repeated, even across restarts of a persistent store.
+type Scheduler struct {
+	store    Store
+	notifier Notifier
+	interval time.Duration
+	logger   *slog.Logger
+	now      func() time.Time
+}
+
+// NewScheduler creates a scheduler checking the store every interval.
+func NewScheduler(store Store, notifier Notifier, interval time.Duration, logger *slog.Logger) *Scheduler {
+	return &Scheduler{
+		store:    store,
+		notifier: notifier,
+		interval: interval,
+		logger:   logger,
+		now:      time.Now,
+	}
+}
+
+// Run delivers due reminders every interval until ctx is cancelled.
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.Tick(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Tick delivers the reminders due now, including those of occurrences that started since the previous tick.
+// Once a reminder of an event fails, the later reminders of the same event
+// wait for the next tick, so that marking them delivered cannot skip the failed one.
+func (s *Scheduler) Tick(ctx context.Context) {
+	type key struct{ userID, ID int }
+	failed := make(map[key]bool)
+
+	for _, due := range s.store.DueReminders(s.now(), s.interval) {
+		k := key{due.Event.UserID, due.Event.ID}
+		if failed[k] {
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err := s.notifier.Notify(ctx, newNotification(due)); err != nil {
+			s.logger.Warn("reminder not delivered", "user_id", k.userID, "event_id", k.ID, "error", err)
+			failed[k] = true
+			continue
+		}
+		if err := s.store.MarkReminded(k.userID, k.ID, due.FireAt); err != nil {
+			s.logger.Error("failed to mark reminder as delivered", "user_id", k.userID, "event_id", k.ID, "error", err)
+			failed[k] = true
+		}
+	}
+}
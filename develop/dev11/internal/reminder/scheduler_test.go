@@ -0,0 +1,80 @@
+package reminder
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"dev11/internal/calendar"
+)
+
+func TestSchedulerWebhook(t *testing.T) {
+	var mu sync.Mutex
+	var received []Notification
+	failing := true
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if failing {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		var notification Notification
+		if err := json.NewDecoder(r.Body).Decode(&notification); err != nil {
+			t.Errorf("webhook body: %v", err)
+		}
+		received = append(received, notification)
+	}))
+	defer hook.Close()
+
+	dir := t.TempDir()
+	store, err := calendar.OpenCalendar(dir, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2025, 1, 16, 10, 0, 0, 0, time.UTC)
+	store.CreateEvent(&calendar.Event{UserID: 1, Title: "Standup", Date: start, Reminders: []int{15}})
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	newScheduler := func(store Store) *Scheduler {
+		s := NewScheduler(store, NewWebhook(hook.URL, time.Second), time.Minute, logger)
+		s.now = func() time.Time { return start.Add(-10 * time.Minute) }
+		return s
+	}
+
+	scheduler := newScheduler(store)
+	scheduler.Tick(context.Background())
+	if len(received) != 0 {
+		t.Fatalf("delivered %d notifications through a failing webhook", len(received))
+	}
+
+	mu.Lock()
+	failing = false
+	mu.Unlock()
+	scheduler.Tick(context.Background())
+	scheduler.Tick(context.Background())
+	if len(received) != 1 {
+		t.Fatalf("delivered %d notifications after the webhook recovered, want 1", len(received))
+	}
+	if got := received[0]; got.EventID != 1 || got.Title != "Standup" || got.MinutesBefore != 15 || !got.Start.Equal(start) {
+		t.Errorf("notification = %+v", got)
+	}
+
+	// A restarted server must not deliver the reminder again.
+	if err = store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if store, err = calendar.OpenCalendar(dir, 100); err != nil {
+		t.Fatal(err)
+	}
+	newScheduler(store).Tick(context.Background())
+	if len(received) != 1 {
+		t.Errorf("delivered %d notifications after a restart, want 1", len(received))
+	}
+}
@@ -0,0 +1,125 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"dev11/internal/calendar"
+)
+
+// MaxBatchSize is the largest number of operations a single batch may hold.
+const MaxBatchSize = 1000
+
+// BatchItem is a single parsed operation of a batch, or the reason it could not be parsed.
+type BatchItem struct {
+	Operation calendar.Operation
+	Err       error
+}
+
+// OperationResult is the outcome of a single operation of a batch: the event as created or updated,
+// or as moved to the trash, or the reason the operation failed.
+type OperationResult struct {
+	Op    string          `json:"op"`
+	Event *calendar.Event `json:"event,omitempty"`
+	Error string          `json:"error,omitempty"`
+}
+
+// OperationsResponse wraps the per-operation outcomes in the result envelope.
+type OperationsResponse struct {
+	Result []OperationResult `json:"result"`
+}
+
+// ParseBatch parses a JSON array of operations. Every operation is an object with an 'op' of create, update or delete
+// and the fields of the matching request: the event for a create, as for ParseEventParams, the JSON merge patch
+// with the required 'id' and the optional 'version' for an update, as for ParsePatchParams, and 'user_id' and 'id'
+// for a delete. An operation that cannot be parsed does not fail the batch but is returned with its error.
+func ParseBatch(r *http.Request, defaultLoc *time.Location) ([]BatchItem, error) {
+	var operations []map[string]json.RawMessage
+	if err := decodeJSON(r, &operations); err != nil {
+		return nil, err
+	}
+	switch {
+	case len(operations) == 0:
+		return nil, errors.New("batch must hold at least one operation")
+	case len(operations) > MaxBatchSize:
+		return nil, fmt.Errorf("batch must not hold more than %d operations", MaxBatchSize)
+	}
+
+	items := make([]BatchItem, len(operations))
+	for i, fields := range operations {
+		items[i].Operation, items[i].Err = parseOperation(r, fields, defaultLoc)
+	}
+	return items, nil
+}
+
+// parseOperation parses a single operation of a batch.
+func parseOperation(r *http.Request, fields map[string]json.RawMessage, defaultLoc *time.Location) (calendar.Operation, error) {
+	var op string
+	if raw, ok := fields["op"]; ok {
+		_ = json.Unmarshal(raw, &op)
+	}
+	delete(fields, "op")
+	operation := calendar.Operation{Op: op}
+
+	switch op {
+	case calendar.ChangeCreate:
+		var event calendar.Event
+		if err := decodeFields(fields, &event); err != nil {
+			return operation, err
+		}
+		if err := prepareEvent(r, &event, defaultLoc); err != nil {
+			return operation, err
+		}
+		operation.Event = &event
+	case calendar.ChangeUpdate:
+		params, err := patchFromFields(r, fields, defaultLoc)
+		if err != nil {
+			return operation, err
+		}
+		if params.ID == 0 {
+			return operation, errors.New("id is required")
+		}
+		operation.UserID, operation.ID, operation.Patch, operation.Version = params.UserID, params.ID, params.Patch, params.Version
+	case calendar.ChangeDelete:
+		var key eventKeyBody
+		if err := decodeFields(fields, &key); err != nil {
+			return operation, err
+		}
+		userID, err := resolveUserID(r, key.UserID)
+		if err != nil {
+			return operation, err
+		}
+		if key.ID <= 0 {
+			return operation, errors.New("id must be a positive integer")
+		}
+		operation.UserID, operation.ID = userID, key.ID
+	default:
+		return operation, fmt.Errorf("op %q is not one of create, update, delete", op)
+	}
+	return operation, nil
+}
+
+// decodeFields decodes the fields of an operation into v, rejecting unknown fields.
+func decodeFields(fields map[string]json.RawMessage, v any) error {
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	if err = decodeStrict(bytes.NewReader(data), v); err != nil {
+		return fmt.Errorf("invalid operation: %w", err)
+	}
+	return nil
+}
+
+// SendOperationResults sends the outcomes of the operations of a batch.
+func SendOperationResults(w http.ResponseWriter, response []OperationResult) error {
+	data := OperationsResponse{response}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err := json.NewEncoder(w).Encode(data)
+	return err
+}
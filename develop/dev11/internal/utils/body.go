@@ -0,0 +1,166 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+
+	"dev11/internal/calendar"
+)
+
+// Media types of the request bodies the API accepts.
+const (
+	FormContentType = "application/x-www-form-urlencoded"
+	JSONContentType = "application/json"
+)
+
+// MediaType returns the media type of the request body without parameters such as charset,
+// or an empty string if the request has no Content-Type.
+func MediaType(r *http.Request) (string, error) {
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		return "", nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", fmt.Errorf("invalid Content-Type %q", contentType)
+	}
+	return mediaType, nil
+}
+
+// isJSON reports whether the request carries a JSON body.
+func isJSON(r *http.Request) bool {
+	mediaType, err := MediaType(r)
+	return err == nil && mediaType == JSONContentType
+}
+
+// eventKeyBody is the JSON body of requests that only identify an event.
+type eventKeyBody struct {
+	UserID int `json:"user_id"`
+	ID     int `json:"id"`
+}
+
+// ParseEventKey parses the required 'user_id' and 'id' of an event from a form or a JSON body.
+func ParseEventKey(r *http.Request) (int, int, error) {
+	if isJSON(r) {
+		var body eventKeyBody
+		if err := decodeJSON(r, &body); err != nil {
+			return 0, 0, err
+		}
+		userID, err := resolveUserID(r, body.UserID)
+		if err != nil {
+			return 0, 0, err
+		}
+		if body.ID <= 0 {
+			return 0, 0, errors.New("id must be a positive integer")
+		}
+		return userID, body.ID, nil
+	}
+
+	if err := r.ParseForm(); err != nil {
+		return 0, 0, errors.New("invalid form data")
+	}
+	userID, err := ParseUserID(r)
+	if err != nil {
+		return 0, 0, err
+	}
+	id, err := parseID(r.FormValue("id"))
+	if err == nil && id == 0 {
+		err = errors.New("id is required")
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	return userID, id, nil
+}
+
+// parseEventJSON decodes an event from a JSON body shaped like calendar.Event, with the date in RFC 3339 format.
+// The event is placed in the zone named by its 'time_zone' field, or by the 'tz' query parameter, or in defaultLoc.
+func parseEventJSON(r *http.Request, defaultLoc *time.Location) (*calendar.Event, error) {
+	var event calendar.Event
+	if err := decodeJSON(r, &event); err != nil {
+		return &calendar.Event{}, err
+	}
+	if err := prepareEvent(r, &event, defaultLoc); err != nil {
+		return &calendar.Event{}, err
+	}
+	return &event, nil
+}
+
+// prepareEvent validates an event decoded from JSON, fills in the user ID and places its dates in the time zone,
+// as described for parseEventJSON.
+func prepareEvent(r *http.Request, event *calendar.Event, defaultLoc *time.Location) error {
+	userID, err := resolveUserID(r, event.UserID)
+	if err != nil {
+		return err
+	}
+	event.UserID = userID
+
+	switch {
+	case event.ID < 0:
+		return errors.New("id must be a positive integer")
+	case event.Title == "":
+		return errors.New("title is required")
+	case event.Date.IsZero():
+		return errors.New("date is required")
+	case len(event.Exceptions) > 0:
+		return errors.New("exceptions cannot be set directly")
+	}
+	if event.Recurrence != nil {
+		if err := event.Recurrence.Validate(); err != nil {
+			return err
+		}
+	}
+	if err := calendar.ValidateReminders(event.Reminders); err != nil {
+		return err
+	}
+	if err := event.Validate(); err != nil {
+		return err
+	}
+
+	loc, err := ParseLocation(r, defaultLoc)
+	if err != nil {
+		return err
+	}
+	if event.TimeZone != "" {
+		if loc, err = time.LoadLocation(event.TimeZone); err != nil {
+			return fmt.Errorf("unknown time zone %q", event.TimeZone)
+		}
+	}
+	event.Date = event.Date.In(loc)
+	if event.End != nil {
+		end := event.End.In(loc)
+		event.End = &end
+	}
+	event.Occurrence = nil
+	event.RemindedUntil = nil
+	event.DeletedAt = nil
+
+	return nil
+}
+
+// decodeJSON decodes the request body into v, rejecting unknown fields and trailing data.
+func decodeJSON(r *http.Request, v any) error {
+	if err := decodeStrict(r.Body, v); err != nil {
+		return fmt.Errorf("invalid JSON body: %w", err)
+	}
+	return nil
+}
+
+// decodeStrict decodes a single JSON value from reader into v, rejecting unknown fields and trailing data.
+func decodeStrict(reader io.Reader, v any) error {
+	decoder := json.NewDecoder(reader)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if decoder.More() {
+		return errors.New("unexpected data after the object")
+	}
+	return nil
+}
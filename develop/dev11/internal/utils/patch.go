@@ -0,0 +1,324 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"dev11/internal/calendar"
+)
+
+// PatchParams are the parsed parameters of a partial update of an event.
+// ID and Version are 0 if the request does not carry them.
+type PatchParams struct {
+	UserID  int
+	ID      int
+	Version int
+	Patch   calendar.Patch
+}
+
+// ParsePatchParams parses a partial update sent either as a form or as a JSON merge patch.
+// Only the fields present in the request are changed: 'title', 'description', 'location', 'date', 'end', 'reminders',
+// 'attendees', 'status' and the recurrence parameters of a form ('repeat=none' removes the recurrence, an empty 'end',
+// 'reminders' or 'attendees' removes them), or the same fields and 'time_zone' and 'recurrence' of a JSON object
+// (null removes the end, the recurrence, the reminders and the attendees). A new date keeps the time zone of the event
+// unless 'time_zone' or the 'tz' parameter is given; the date and end of a form are then its clock times.
+// The expected version of the event is taken from the If-Match header or, failing that, from the 'version' parameter.
+func ParsePatchParams(r *http.Request, defaultLoc *time.Location) (*PatchParams, error) {
+	var params *PatchParams
+	var err error
+	if isJSON(r) {
+		params, err = parsePatchJSON(r, defaultLoc)
+	} else {
+		params, err = parsePatchForm(r, defaultLoc)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := ParseIfMatch(r)
+	if err != nil {
+		return nil, err
+	}
+	if version != 0 {
+		params.Version = version
+	}
+	return params, nil
+}
+
+// parsePatchForm parses a partial update sent as a form.
+func parsePatchForm(r *http.Request, defaultLoc *time.Location) (*PatchParams, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, errors.New("invalid form data")
+	}
+
+	loc, err := ParseLocation(r, defaultLoc)
+	if err != nil {
+		return nil, err
+	}
+
+	params := &PatchParams{}
+	// Without 'tz' the new date and end are the clock times of the event's own time zone.
+	dateLoc := loc
+	if r.FormValue("tz") == "" {
+		dateLoc = time.UTC
+		params.Patch.KeepTimeZone, params.Patch.LocalTimes = true, true
+	}
+	if params.UserID, err = ParseUserID(r); err != nil {
+		return nil, err
+	}
+	if params.ID, err = parseID(r.FormValue("id")); err != nil {
+		return nil, err
+	}
+	if params.Version, err = parseOptionalInt(r, "version"); err != nil {
+		return nil, err
+	}
+
+	if _, ok := r.Form["title"]; ok {
+		title := r.FormValue("title")
+		if title == "" {
+			return nil, errors.New("title must not be empty")
+		}
+		params.Patch.Title = &title
+	}
+	if _, ok := r.Form["date"]; ok {
+		date, err := parseDateTime(r, "date", dateLoc)
+		if err != nil {
+			return nil, err
+		}
+		params.Patch.Date = &date
+	}
+	if _, ok := r.Form["description"]; ok {
+		description := r.FormValue("description")
+		params.Patch.Description = &description
+	}
+	if _, ok := r.Form["location"]; ok {
+		location := r.FormValue("location")
+		params.Patch.Location = &location
+	}
+	if _, ok := r.Form["end"]; ok && r.FormValue("end") == "" {
+		params.Patch.RemoveEnd = true
+	} else if ok {
+		end, err := parseDateTime(r, "end", dateLoc)
+		if err != nil {
+			return nil, err
+		}
+		params.Patch.End = &end
+	}
+	if _, ok := r.Form["attendees"]; ok {
+		attendees := parseAttendees(r.FormValue("attendees"))
+		params.Patch.Attendees = &attendees
+	}
+	if _, ok := r.Form["status"]; ok {
+		status := calendar.Status(r.FormValue("status"))
+		params.Patch.Status = &status
+	}
+	if _, ok := r.Form["reminders"]; ok {
+		reminders, err := parseReminders(r.FormValue("reminders"))
+		if err != nil {
+			return nil, err
+		}
+		params.Patch.Reminders = &reminders
+	}
+	if r.FormValue("repeat") == "none" {
+		params.Patch.RemoveRecurrence = true
+	} else if params.Patch.Recurrence, err = parseRecurrence(r, loc); err != nil {
+		return nil, err
+	}
+
+	return params, nil
+}
+
+// patchFields are the fields a JSON merge patch may contain.
+var patchFields = []string{
+	"user_id", "id", "version", "title", "description", "location", "date", "end", "time_zone",
+	"recurrence", "reminders", "attendees", "status",
+}
+
+// parsePatchJSON parses a partial update sent as a JSON merge patch. If the patch has no 'user_id',
+// it is taken from the query string.
+func parsePatchJSON(r *http.Request, defaultLoc *time.Location) (*PatchParams, error) {
+	var fields map[string]json.RawMessage
+	if err := decodeJSON(r, &fields); err != nil {
+		return nil, err
+	}
+	return patchFromFields(r, fields, defaultLoc)
+}
+
+// patchFromFields parses the fields of a JSON merge patch, as described for parsePatchJSON.
+func patchFromFields(r *http.Request, fields map[string]json.RawMessage, defaultLoc *time.Location) (*PatchParams, error) {
+	for name := range fields {
+		if !slices.Contains(patchFields, name) {
+			return nil, fmt.Errorf("unknown field %q", name)
+		}
+	}
+
+	params := &PatchParams{}
+	field := func(name string, v any) (bool, error) {
+		raw, ok := fields[name]
+		if !ok {
+			return false, nil
+		}
+		if string(raw) == "null" {
+			return true, fmt.Errorf("%s must not be null", name)
+		}
+		if err := json.Unmarshal(raw, v); err != nil {
+			return true, fmt.Errorf("invalid %s: %w", name, err)
+		}
+		return true, nil
+	}
+
+	hasUserID, err := field("user_id", &params.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if hasUserID {
+		params.UserID, err = resolveUserID(r, params.UserID)
+	} else {
+		params.UserID, err = ParseUserID(r)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err = field("id", &params.ID); err != nil {
+		return nil, err
+	}
+	if _, err = field("version", &params.Version); err != nil {
+		return nil, err
+	}
+	if params.ID < 0 || params.Version < 0 {
+		return nil, errors.New("id and version must not be negative")
+	}
+
+	var title string
+	if ok, err := field("title", &title); err != nil {
+		return nil, err
+	} else if ok {
+		if title == "" {
+			return nil, errors.New("title must not be empty")
+		}
+		params.Patch.Title = &title
+	}
+
+	var description string
+	if ok, err := field("description", &description); err != nil {
+		return nil, err
+	} else if ok {
+		params.Patch.Description = &description
+	}
+
+	var location string
+	if ok, err := field("location", &location); err != nil {
+		return nil, err
+	} else if ok {
+		params.Patch.Location = &location
+	}
+
+	var date time.Time
+	hasDate, err := field("date", &date)
+	if err != nil {
+		return nil, err
+	}
+	var zone string
+	hasZone, err := field("time_zone", &zone)
+	if err != nil {
+		return nil, err
+	}
+	if hasZone && !hasDate {
+		return nil, errors.New("time_zone can only be changed together with date")
+	}
+	if hasDate {
+		loc, err := ParseLocation(r, defaultLoc)
+		if err != nil {
+			return nil, err
+		}
+		if hasZone {
+			if loc, err = time.LoadLocation(zone); err != nil {
+				return nil, fmt.Errorf("unknown time zone %q", zone)
+			}
+		}
+		// Without 'time_zone' or 'tz' the event stays in its own time zone.
+		if hasZone || r.FormValue("tz") != "" {
+			date = date.In(loc)
+		} else {
+			params.Patch.KeepTimeZone = true
+		}
+		params.Patch.Date = &date
+	}
+
+	if raw, ok := fields["end"]; ok && string(raw) == "null" {
+		params.Patch.RemoveEnd = true
+	} else if ok {
+		var end time.Time
+		if err = json.Unmarshal(raw, &end); err != nil {
+			return nil, fmt.Errorf("invalid end: %w", err)
+		}
+		params.Patch.End = &end
+	}
+
+	if raw, ok := fields["recurrence"]; ok && string(raw) == "null" {
+		params.Patch.RemoveRecurrence = true
+	} else if ok {
+		var rule calendar.Recurrence
+		if err = json.Unmarshal(raw, &rule); err != nil {
+			return nil, fmt.Errorf("invalid recurrence: %w", err)
+		}
+		if err = rule.Validate(); err != nil {
+			return nil, err
+		}
+		params.Patch.Recurrence = &rule
+	}
+
+	if raw, ok := fields["reminders"]; ok {
+		var reminders []int
+		if err = json.Unmarshal(raw, &reminders); err != nil {
+			return nil, fmt.Errorf("invalid reminders: %w", err)
+		}
+		if err = calendar.ValidateReminders(reminders); err != nil {
+			return nil, err
+		}
+		params.Patch.Reminders = &reminders
+	}
+
+	if raw, ok := fields["attendees"]; ok {
+		var attendees []string
+		if err = json.Unmarshal(raw, &attendees); err != nil {
+			return nil, fmt.Errorf("invalid attendees: %w", err)
+		}
+		params.Patch.Attendees = &attendees
+	}
+
+	var status calendar.Status
+	if ok, err := field("status", &status); err != nil {
+		return nil, err
+	} else if ok {
+		params.Patch.Status = &status
+	}
+
+	return params, nil
+}
+
+// ParseIfMatch returns the event version required by the If-Match header, or 0 if any version will do.
+func ParseIfMatch(r *http.Request) (int, error) {
+	value := strings.TrimSpace(r.Header.Get("If-Match"))
+	if value == "" || value == "*" {
+		return 0, nil
+	}
+
+	tag := strings.Trim(strings.TrimPrefix(value, "W/"), `"`)
+	version, err := strconv.Atoi(tag)
+	if err != nil || version <= 0 {
+		return 0, fmt.Errorf("If-Match %q is not an event ETag", value)
+	}
+	return version, nil
+}
+
+// ETag returns the entity tag of the given version of an event.
+func ETag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
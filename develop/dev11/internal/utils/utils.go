@@ -3,30 +3,92 @@ package utils
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
+	"dev11/internal/auth"
 	"dev11/internal/calendar"
 )
 
+const (
+	dateLayout     = "2006-01-02"
+	dateTimeLayout = "2006-01-02 15:04"
+)
+
+// weekdays maps the iCalendar two-letter weekday names to weekdays.
+var weekdays = map[string]time.Weekday{
+	"mo": time.Monday,
+	"tu": time.Tuesday,
+	"we": time.Wednesday,
+	"th": time.Thursday,
+	"fr": time.Friday,
+	"sa": time.Saturday,
+	"su": time.Sunday,
+}
+
 type ResultResponse struct {
 	Result string `json:"result"`
 }
 
+// ErrorResponse carries the error message together with the ID of the request,
+// so that a failed request can be found in the logs.
 type ErrorResponse struct {
-	Error string `json:"error"`
+	Error     string `json:"error"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// EventResponse wraps a single event in the result envelope.
+type EventResponse struct {
+	Result calendar.Event `json:"result"`
+}
+
+// SlotsResponse wraps free slots in the result envelope.
+type SlotsResponse struct {
+	Result []calendar.Slot `json:"result"`
+}
+
+// AuditResponse wraps audit entries in the result envelope.
+type AuditResponse struct {
+	Result []calendar.AuditEntry `json:"result"`
+}
+
+// ItemResult is the outcome of a single item of a request that processes several items at once:
+// either the ID the item was stored under, or the reason it was rejected.
+type ItemResult struct {
+	Item  string `json:"item"`
+	ID    int    `json:"id,omitempty"`
+	Error string `json:"error,omitempty"`
 }
 
-// ParseEventParams Parsing and validation of parameters.
-func ParseEventParams(r *http.Request) (*calendar.Event, error) {
+// ItemsResponse wraps the per-item outcomes in the result envelope.
+type ItemsResponse struct {
+	Result []ItemResult `json:"result"`
+}
+
+// ParseEventParams Parsing and validation of parameters, sent either as a form or as a JSON body.
+// The 'id' parameter is optional; an absent ID is returned as 0. Besides 'title' and 'date', a form may give
+// the 'end' or 'duration', 'description', 'location', 'attendees' and 'status' of the event.
+// Dates are taken in the time zone given by the 'tz' parameter, or in defaultLoc if it is absent.
+func ParseEventParams(r *http.Request, defaultLoc *time.Location) (*calendar.Event, error) {
+	if isJSON(r) {
+		return parseEventJSON(r, defaultLoc)
+	}
+
 	if err := r.ParseForm(); err != nil {
 		return &calendar.Event{}, errors.New("invalid form data")
 	}
 
-	idStr := r.FormValue("id")
-	if idStr == "" {
-		return &calendar.Event{}, errors.New("id is required")
+	loc, err := ParseLocation(r, defaultLoc)
+	if err != nil {
+		return &calendar.Event{}, err
+	}
+
+	userID, err := ParseUserID(r)
+	if err != nil {
+		return &calendar.Event{}, err
 	}
 
 	title := r.FormValue("title")
@@ -39,21 +101,424 @@ func ParseEventParams(r *http.Request) (*calendar.Event, error) {
 		return &calendar.Event{}, errors.New("date is required")
 	}
 
-	id, err := strconv.Atoi(idStr)
+	id, err := parseID(r.FormValue("id"))
 	if err != nil {
-		return &calendar.Event{}, errors.New("id must be a valid integer")
+		return &calendar.Event{}, err
 	}
 
-	date, err := time.Parse("2006-01-02 15:04", dateStr)
+	date, err := time.ParseInLocation(dateTimeLayout, dateStr, loc)
 	if err != nil {
 		return &calendar.Event{}, errors.New("date must be in YYYY-MM-DD hh:mm format")
 	}
 
-	return &calendar.Event{
-		ID:    id,
-		Title: title,
-		Date:  date,
-	}, nil
+	recurrence, err := parseRecurrence(r, loc)
+	if err != nil {
+		return &calendar.Event{}, err
+	}
+
+	reminders, err := parseReminders(r.FormValue("reminders"))
+	if err != nil {
+		return &calendar.Event{}, err
+	}
+
+	end, err := parseEnd(r, date, loc)
+	if err != nil {
+		return &calendar.Event{}, err
+	}
+
+	event := &calendar.Event{
+		ID:          id,
+		UserID:      userID,
+		Title:       title,
+		Description: r.FormValue("description"),
+		Location:    r.FormValue("location"),
+		Date:        date,
+		End:         end,
+		Recurrence:  recurrence,
+		Reminders:   reminders,
+		Attendees:   parseAttendees(r.FormValue("attendees")),
+		Status:      calendar.Status(r.FormValue("status")),
+	}
+	if err = event.Validate(); err != nil {
+		return &calendar.Event{}, err
+	}
+	return event, nil
+}
+
+// parseEnd parses the optional end of an event starting at date: either the 'end' parameter
+// in YYYY-MM-DD hh:mm format or the 'duration' parameter in minutes. It returns nil if neither is given.
+func parseEnd(r *http.Request, date time.Time, loc *time.Location) (*time.Time, error) {
+	_, hasEnd := r.Form["end"]
+	_, hasDuration := r.Form["duration"]
+	switch {
+	case hasEnd && hasDuration:
+		return nil, errors.New("end and duration are mutually exclusive")
+	case hasEnd:
+		end, err := parseDateTime(r, "end", loc)
+		if err != nil {
+			return nil, err
+		}
+		return &end, nil
+	case hasDuration:
+		minutes, err := strconv.Atoi(r.FormValue("duration"))
+		if err != nil || minutes <= 0 {
+			return nil, errors.New("duration must be a positive number of minutes")
+		}
+		end := date.Add(time.Duration(minutes) * time.Minute)
+		return &end, nil
+	default:
+		return nil, nil
+	}
+}
+
+// parseAttendees parses the 'attendees' parameter: a comma-separated list of e-mail addresses.
+// It returns nil if the list is empty; the addresses are checked by Event.Validate.
+func parseAttendees(value string) []string {
+	var attendees []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			attendees = append(attendees, item)
+		}
+	}
+	return attendees
+}
+
+// parseReminders parses the 'reminders' parameter: a comma-separated list of minutes before the event,
+// e.g. 15,60. It returns nil if the list is empty.
+func parseReminders(value string) ([]int, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	var reminders []int
+	for _, item := range strings.Split(value, ",") {
+		minutes, err := strconv.Atoi(strings.TrimSpace(item))
+		if err != nil {
+			return nil, errors.New("reminders must be a comma-separated list of minutes")
+		}
+		reminders = append(reminders, minutes)
+	}
+	if err := calendar.ValidateReminders(reminders); err != nil {
+		return nil, err
+	}
+	return reminders, nil
+}
+
+// parseRecurrence parses the optional recurrence parameters: 'repeat' (daily, weekly or monthly), 'interval',
+// 'by_day' (comma-separated two-letter weekdays, e.g. mo,we,fr), 'count' and 'until'.
+// It returns nil if the event does not repeat.
+func parseRecurrence(r *http.Request, loc *time.Location) (*calendar.Recurrence, error) {
+	repeat := r.FormValue("repeat")
+	if repeat == "" {
+		return nil, nil
+	}
+
+	rule := &calendar.Recurrence{Freq: calendar.Frequency(repeat)}
+	var err error
+	if rule.Interval, err = parseOptionalInt(r, "interval"); err != nil {
+		return nil, err
+	}
+	if rule.Count, err = parseOptionalInt(r, "count"); err != nil {
+		return nil, err
+	}
+
+	if byDay := r.FormValue("by_day"); byDay != "" {
+		for _, name := range strings.Split(byDay, ",") {
+			day, ok := ParseWeekday(name)
+			if !ok {
+				return nil, fmt.Errorf("unknown weekday %q in by_day", name)
+			}
+			rule.ByDay = append(rule.ByDay, day)
+		}
+	}
+
+	if untilStr := r.FormValue("until"); untilStr != "" {
+		until, dateOnly, err := parseBound(untilStr, "until", loc)
+		if err != nil {
+			return nil, err
+		}
+		if dateOnly {
+			// The whole last day is included.
+			until = until.AddDate(0, 0, 1).Add(-time.Nanosecond)
+		}
+		rule.Until = &until
+	}
+
+	if err = rule.Validate(); err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+// ParseExceptionParams parses the parameters of an occurrence exception: the required 'user_id', 'id'
+// and 'occurrence' (the original start of the occurrence, YYYY-MM-DD hh:mm) and, if moved is set,
+// the new 'date' of the occurrence. Dates are taken in the 'tz' time zone, or in defaultLoc.
+func ParseExceptionParams(r *http.Request, moved bool, defaultLoc *time.Location) (int, int, calendar.Exception, error) {
+	if err := r.ParseForm(); err != nil {
+		return 0, 0, calendar.Exception{}, errors.New("invalid form data")
+	}
+
+	loc, err := ParseLocation(r, defaultLoc)
+	if err != nil {
+		return 0, 0, calendar.Exception{}, err
+	}
+
+	userID, err := ParseUserID(r)
+	if err != nil {
+		return 0, 0, calendar.Exception{}, err
+	}
+	id, err := parseID(r.FormValue("id"))
+	if err == nil && id == 0 {
+		err = errors.New("id is required")
+	}
+	if err != nil {
+		return 0, 0, calendar.Exception{}, err
+	}
+
+	occurrence, err := parseDateTime(r, "occurrence", loc)
+	if err != nil {
+		return 0, 0, calendar.Exception{}, err
+	}
+	exception := calendar.Exception{Occurrence: occurrence, Cancelled: !moved}
+
+	if moved {
+		date, err := parseDateTime(r, "date", loc)
+		if err != nil {
+			return 0, 0, calendar.Exception{}, err
+		}
+		exception.Date = &date
+	}
+	return userID, id, exception, nil
+}
+
+// parseDateTime parses the required named parameter in YYYY-MM-DD hh:mm format, in the given location.
+func parseDateTime(r *http.Request, name string, loc *time.Location) (time.Time, error) {
+	value := r.FormValue(name)
+	if value == "" {
+		return time.Time{}, fmt.Errorf("%s is required", name)
+	}
+
+	t, err := time.ParseInLocation(dateTimeLayout, value, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s must be in YYYY-MM-DD hh:mm format", name)
+	}
+	return t, nil
+}
+
+// ParseWeekday parses a two-letter weekday name, such as mo or Fr.
+func ParseWeekday(name string) (time.Weekday, bool) {
+	day, ok := weekdays[strings.ToLower(strings.TrimSpace(name))]
+	return day, ok
+}
+
+// Page sizes of listings.
+const (
+	DefaultPageSize = 100
+	MaxPageSize     = 1000
+)
+
+// ParseListOptions parses the query parameters shared by all listings: 'limit', the page size of at most MaxPageSize
+// events, DefaultPageSize by default; 'page_token', the next_page_token of the previous page; 'sort', date or title;
+// and 'q', a text to look for in the titles.
+func ParseListOptions(r *http.Request) (calendar.ListOptions, error) {
+	query := r.URL.Query()
+	options := calendar.ListOptions{
+		Limit: DefaultPageSize,
+		Sort:  calendar.SortByDate,
+		Query: query.Get("q"),
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > MaxPageSize {
+			return calendar.ListOptions{}, fmt.Errorf("limit must be an integer between 1 and %d", MaxPageSize)
+		}
+		options.Limit = limit
+	}
+
+	switch sort := calendar.SortOrder(query.Get("sort")); sort {
+	case "":
+	case calendar.SortByDate, calendar.SortByTitle:
+		options.Sort = sort
+	default:
+		return calendar.ListOptions{}, fmt.Errorf("sort %q is not one of date, title", sort)
+	}
+
+	if token := query.Get("page_token"); token != "" {
+		cursor, err := calendar.ParseCursor(token)
+		if err != nil {
+			return calendar.ListOptions{}, err
+		}
+		if cursor.Sort != options.Sort {
+			return calendar.ListOptions{}, errors.New("page_token belongs to a listing with another sort order")
+		}
+		options.After = cursor
+	}
+	return options, nil
+}
+
+// ParseBoolParam parses the named optional boolean parameter, taken from the query string or from the form body,
+// returning false if it is absent.
+func ParseBoolParam(r *http.Request, name string) (bool, error) {
+	value := r.FormValue(name)
+	if value == "" {
+		return false, nil
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("%s must be true or false", name)
+	}
+	return b, nil
+}
+
+// parseOptionalInt parses the named non-negative integer parameter, returning 0 if it is empty.
+func parseOptionalInt(r *http.Request, name string) (int, error) {
+	value := r.FormValue(name)
+	if value == "" {
+		return 0, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative integer", name)
+	}
+	return n, nil
+}
+
+// ParseUserID parses and validates the required 'user_id' parameter, taken from the query string
+// or from the form body. For an authenticated request the parameter is optional and defaults to the
+// authenticated user; see resolveUserID.
+func ParseUserID(r *http.Request) (int, error) {
+	userIDStr := r.FormValue("user_id")
+	if userIDStr == "" {
+		if principal, ok := auth.FromContext(r.Context()); ok {
+			return principal.UserID, nil
+		}
+		return 0, errors.New("user_id is required")
+	}
+
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil || userID <= 0 {
+		return 0, errors.New("user_id must be a positive integer")
+	}
+	return resolveUserID(r, userID)
+}
+
+// resolveUserID returns the owner of the events a request acts on. For an authenticated request it is
+// the authenticated user, and a user ID given in the request must match it. Otherwise it is the given
+// user ID, which must be positive.
+func resolveUserID(r *http.Request, userID int) (int, error) {
+	if principal, ok := auth.FromContext(r.Context()); ok {
+		if userID != 0 && userID != principal.UserID {
+			return 0, errors.New("user_id does not match the authenticated user")
+		}
+		return principal.UserID, nil
+	}
+
+	if userID <= 0 {
+		return 0, errors.New("user_id must be a positive integer")
+	}
+	return userID, nil
+}
+
+// parseID parses an optional event ID, returning 0 if it is empty.
+func parseID(idStr string) (int, error) {
+	if idStr == "" {
+		return 0, nil
+	}
+
+	id, err := strconv.Atoi(idStr)
+	if err != nil || id <= 0 {
+		return 0, errors.New("id must be a positive integer")
+	}
+	return id, nil
+}
+
+// ParsePathID parses the event ID from the '{id}' wildcard of the request path.
+func ParsePathID(r *http.Request) (int, error) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id <= 0 {
+		return 0, errors.New("id must be a positive integer")
+	}
+	return id, nil
+}
+
+// ParseLocation returns the time zone named by the 'tz' parameter, an IANA name such as Europe/Moscow,
+// or fallback if the parameter is absent.
+func ParseLocation(r *http.Request, fallback *time.Location) (*time.Location, error) {
+	name := r.FormValue("tz")
+	if name == "" {
+		return fallback, nil
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %q", name)
+	}
+	return loc, nil
+}
+
+// ParseDateParam parses the named query parameter as a YYYY-MM-DD date in the 'tz' time zone, or in defaultLoc.
+// If the parameter is absent, today's date in that zone is returned.
+func ParseDateParam(r *http.Request, name string, defaultLoc *time.Location) (time.Time, error) {
+	loc, err := ParseLocation(r, defaultLoc)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	dateStr := r.URL.Query().Get(name)
+	if dateStr == "" {
+		return time.Now().In(loc), nil
+	}
+
+	date, err := time.ParseInLocation(dateLayout, dateStr, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s must be in YYYY-MM-DD format", name)
+	}
+	return date, nil
+}
+
+// ParseRangeParams parses the required 'from' and 'to' query parameters into a half-open interval [from, to).
+// Each bound is either a YYYY-MM-DD date or a YYYY-MM-DD hh:mm timestamp; a bare 'to' date includes the whole day.
+// The bounds are taken in the 'tz' time zone, or in defaultLoc.
+func ParseRangeParams(r *http.Request, defaultLoc *time.Location) (time.Time, time.Time, error) {
+	loc, err := ParseLocation(r, defaultLoc)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	query := r.URL.Query()
+
+	from, _, err := parseBound(query.Get("from"), "from", loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	to, dateOnly, err := parseBound(query.Get("to"), "to", loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if dateOnly {
+		to = to.AddDate(0, 0, 1)
+	}
+
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, errors.New("from must be before to")
+	}
+	return from, to, nil
+}
+
+// parseBound parses one bound of a range in the given location and reports whether it was given as a bare date.
+func parseBound(value, name string, loc *time.Location) (time.Time, bool, error) {
+	if value == "" {
+		return time.Time{}, false, fmt.Errorf("%s is required", name)
+	}
+	if t, err := time.ParseInLocation(dateTimeLayout, value, loc); err == nil {
+		return t, false, nil
+	}
+	if t, err := time.ParseInLocation(dateLayout, value, loc); err == nil {
+		return t, true, nil
+	}
+	return time.Time{}, false, fmt.Errorf("%s must be in YYYY-MM-DD or YYYY-MM-DD hh:mm format", name)
 }
 
 func SendResult(w http.ResponseWriter, response string) error {
@@ -64,16 +529,54 @@ func SendResult(w http.ResponseWriter, response string) error {
 	return err
 }
 
-func SendEvents(w http.ResponseWriter, response []calendar.Event) error {
-	data := calendar.Result{Result: response}
+func SendEvents(w http.ResponseWriter, data calendar.Result) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err := json.NewEncoder(w).Encode(data)
+	return err
+}
+
+// SendEvent sends the event together with its ETag with the given status code.
+func SendEvent(w http.ResponseWriter, event calendar.Event, statusCode int) error {
+	data := EventResponse{event}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", ETag(event.Version))
+	w.WriteHeader(statusCode)
+	err := json.NewEncoder(w).Encode(data)
+	return err
+}
+
+// SendSlots sends the free time slots.
+func SendSlots(w http.ResponseWriter, response []calendar.Slot) error {
+	data := SlotsResponse{response}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err := json.NewEncoder(w).Encode(data)
+	return err
+}
+
+// SendAuditEntries sends the entries of the audit log.
+func SendAuditEntries(w http.ResponseWriter, response []calendar.AuditEntry) error {
+	data := AuditResponse{response}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err := json.NewEncoder(w).Encode(data)
+	return err
+}
+
+// SendItemResults sends the outcome of every item of a request that processes several items at once.
+func SendItemResults(w http.ResponseWriter, response []ItemResult) error {
+	data := ItemsResponse{response}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	err := json.NewEncoder(w).Encode(data)
 	return err
 }
 
+// SendError sends the error with the given status code. The request ID is taken from the X-Request-ID header
+// already set on the response by the middleware.
 func SendError(w http.ResponseWriter, err error, statusCode int) {
-	data := ErrorResponse{err.Error()}
+	data := ErrorResponse{Error: err.Error(), RequestID: w.Header().Get("X-Request-ID")}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
 	_ = json.NewEncoder(w).Encode(data)